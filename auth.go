@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultJWTExpiry        = time.Hour
+	refreshTokenExpiry      = 60 * 24 * time.Hour
+	emailVerificationExpiry = 24 * time.Hour
+)
+
+// hashPassword hashes password with the given bcrypt work factor. A cost
+// below bcrypt.MinCost means bcrypt.DefaultCost.
+func hashPassword(password string, cost int) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func checkPasswordHash(password, hash string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
+
+// defaultJWTKeyID names the key built from a plain JWT_SECRET.
+const defaultJWTKeyID = "default"
+
+// jwtKeys holds the HMAC secrets that access tokens may be signed with,
+// keyed by kid. New tokens are always signed with the current key; older
+// keys keep verifying until they are dropped from the map, which is what
+// allows a secret to be rotated without logging everyone out.
+type jwtKeys struct {
+	current string
+	secrets map[string]string
+}
+
+// singleJWTKey wraps a lone secret, as configured by JWT_SECRET.
+func singleJWTKey(secret string) jwtKeys {
+	return jwtKeys{
+		current: defaultJWTKeyID,
+		secrets: map[string]string{defaultJWTKeyID: secret},
+	}
+}
+
+// parseJWTKeys reads a JSON object of kid to secret, as configured by
+// JWT_SECRETS, and checks that current names one of them.
+func parseJWTKeys(secretsJSON, current string) (jwtKeys, error) {
+	var secrets map[string]string
+	if err := json.Unmarshal([]byte(secretsJSON), &secrets); err != nil {
+		return jwtKeys{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+	for kid, secret := range secrets {
+		if secret == "" {
+			return jwtKeys{}, fmt.Errorf("empty secret for kid %q", kid)
+		}
+	}
+	if _, ok := secrets[current]; !ok {
+		return jwtKeys{}, fmt.Errorf("current kid %q not found", current)
+	}
+	return jwtKeys{current: current, secrets: secrets}, nil
+}
+
+// makeJWT signs an access token for userID. A non-empty audience is
+// recorded in the aud claim.
+func makeJWT(userID uuid.UUID, keys jwtKeys, audience string, expiresIn time.Duration) (string, error) {
+	if expiresIn <= 0 {
+		expiresIn = defaultJWTExpiry
+	}
+
+	now := time.Now().UTC()
+	claims := jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		Subject:   userID.String(),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+	}
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = keys.current
+	return token.SignedString([]byte(keys.secrets[keys.current]))
+}
+
+// validateJWT checks the token's signature and claims and returns its
+// subject. When audience is non-empty the token must have been minted for
+// it; an empty audience skips the check.
+func validateJWT(tokenString string, keys jwtKeys, audience string) (uuid.UUID, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer("chirpy"),
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		// Tokens issued before key IDs existed carry no kid and were
+		// signed with what is now the current key.
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = keys.current
+		}
+		secret, ok := keys.secrets[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return []byte(secret), nil
+	}, opts...)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, errors.New("token has an invalid subject")
+	}
+	return userID, nil
+}
+
+func getBearerToken(headers http.Header) (string, error) {
+	authHeader := headers.Get("Authorization")
+	if authHeader == "" {
+		return "", errors.New("authorization header missing")
+	}
+
+	token, found := strings.CutPrefix(authHeader, "Bearer ")
+	token = strings.TrimSpace(token)
+	if !found || token == "" {
+		return "", errors.New("malformed authorization header")
+	}
+	return token, nil
+}
+
+func makeRefreshToken() (string, error) {
+	return makeRandomToken()
+}
+
+func makeVerificationToken() (string, error) {
+	return makeRandomToken()
+}
+
+// makeRandomToken returns 32 random bytes, hex-encoded.
+func makeRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func getAPIKey(headers http.Header) (string, error) {
+	authHeader := headers.Get("Authorization")
+	if authHeader == "" {
+		return "", errors.New("authorization header missing")
+	}
+
+	key, found := strings.CutPrefix(authHeader, "ApiKey ")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return "", errors.New("malformed authorization header")
+	}
+	return key, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinSize is the smallest response body worth compressing; below it the
+// gzip header and trailer outweigh the savings.
+const gzipMinSize = 1024
+
+// gzipResponseWriter buffers the start of a response until it knows whether
+// the body is large enough, and of a suitable type, to compress.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	buf     []byte
+	status  int
+	decided bool
+}
+
+func (gw *gzipResponseWriter) WriteHeader(code int) {
+	if gw.decided {
+		gw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if gw.status == 0 {
+		gw.status = code
+	}
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if gw.decided {
+		if gw.gz != nil {
+			return gw.gz.Write(b)
+		}
+		return gw.ResponseWriter.Write(b)
+	}
+
+	gw.buf = append(gw.buf, b...)
+	if len(gw.buf) >= gzipMinSize {
+		if err := gw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush commits to a decision early so that streaming handlers still reach
+// the client promptly.
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.decided {
+		gw.decide(true)
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// decide writes the buffered status and body, compressing from here on if
+// allowed and the response looks compressible.
+func (gw *gzipResponseWriter) decide(allowed bool) error {
+	gw.decided = true
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+
+	h := gw.Header()
+	if h.Get("Content-Type") == "" && len(gw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(gw.buf))
+	}
+	if allowed && gw.status == http.StatusOK && h.Get("Content-Encoding") == "" && isCompressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+
+	gw.ResponseWriter.WriteHeader(gw.status)
+	if len(gw.buf) == 0 {
+		return nil
+	}
+	_, err := gw.Write(gw.buf)
+	gw.buf = nil
+	return err
+}
+
+// close finishes the response: small bodies that never reached gzipMinSize
+// are sent as-is, and an active gzip stream gets its trailer.
+func (gw *gzipResponseWriter) close() {
+	if !gw.decided {
+		if gw.status == 0 && len(gw.buf) == 0 {
+			return
+		}
+		gw.decide(false)
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+	}
+}
+
+// isCompressible reports whether a response of the given content type is
+// likely to shrink under gzip. Images such as the logo are already
+// compressed. Server-Sent Events are left alone: the compressor would hold
+// events and keep-alives back until enough bytes pile up.
+func isCompressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		return false
+	}
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "javascript") ||
+		strings.Contains(contentType, "xml")
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip,
+// honoring an explicit q=0 refusal.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+		return true
+	}
+	return false
+}
+
+func (cfg *apiConfig) middlewareGzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gzipTestHandler serves body with the given content type behind
+// middlewareGzip.
+func gzipTestHandler(contentType, body string) http.Handler {
+	cfg := &apiConfig{}
+	return cfg.middlewareGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}))
+}
+
+func serveGzipTest(h http.Handler, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddlewareGzipCompressesJSON(t *testing.T) {
+	body := `[` + strings.Repeat(`{"body":"hello world"},`, 100) + `{}]`
+	rec := serveGzipTest(gzipTestHandler("application/json", body), "gzip")
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Error("decompressed body does not match")
+	}
+}
+
+func TestMiddlewareGzipPlainClient(t *testing.T) {
+	body := strings.Repeat("a", 2*gzipMinSize)
+	rec := serveGzipTest(gzipTestHandler("application/json", body), "")
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+	if rec.Body.String() != body {
+		t.Error("body was altered for a client without gzip")
+	}
+}
+
+func TestMiddlewareGzipSkips(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		acceptEncoding string
+	}{
+		{"small response", "application/json", `{"ok":true}`, "gzip"},
+		{"already compressed image", "image/png", strings.Repeat("a", 2*gzipMinSize), "gzip"},
+		{"gzip refused", "application/json", strings.Repeat("a", 2*gzipMinSize), "gzip;q=0"},
+		{"event stream", "text/event-stream", strings.Repeat("data: a\n\n", gzipMinSize), "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveGzipTest(gzipTestHandler(tt.contentType, tt.body), tt.acceptEncoding)
+			if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+			if rec.Body.String() != tt.body {
+				t.Error("body was altered")
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// WithTx runs fn against a transaction on db. The transaction is committed
+// if fn returns nil and rolled back otherwise, so multi-step writes either
+// land together or not at all.
+func WithTx(ctx context.Context, db *sql.DB, fn func(q *Queries) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(New(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
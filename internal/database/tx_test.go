@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// openTestDB connects to DB_URL with a fresh schema as the search path,
+// applies the Up section of every migration in sql/schema to it, and drops
+// the schema when the test ends, the same way newTestDB does for the server
+// tests. The test is skipped when DB_URL is unset.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		t.Skip("DB_URL not set")
+	}
+
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "chirpy_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("dropping schema: %v", err)
+		}
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(dbURL, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob("../../sql/schema/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("finding migrations: %v", err)
+	}
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, up, found := strings.Cut(string(migration), "-- +goose Up")
+		if !found {
+			up = string(migration)
+		}
+		up, _, _ = strings.Cut(up, "-- +goose Down")
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("applying %s: %v", filepath.Base(file), err)
+		}
+	}
+	return db
+}
+
+// withSearchPath sets search_path on either form of Postgres DSN.
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	email := "tx-rollback-" + uuid.NewString() + "@example.com"
+	errMidway := errors.New("fail after first write")
+
+	err := WithTx(ctx, db, func(q *Queries) error {
+		user, err := q.CreateUser(ctx, CreateUserParams{Email: email, HashedPassword: "x"})
+		if err != nil {
+			return err
+		}
+		if _, err := q.CreateChirp(ctx, CreateChirpParams{Body: "never committed", UserID: user.ID}); err != nil {
+			return err
+		}
+		return errMidway
+	})
+	if !errors.Is(err, errMidway) {
+		t.Fatalf("WithTx error = %v, want %v", err, errMidway)
+	}
+
+	if _, err := New(db).GetUserByEmail(ctx, email); err != sql.ErrNoRows {
+		t.Errorf("GetUserByEmail after rollback: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestWithTxCommits(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	email := "tx-commit-" + uuid.NewString() + "@example.com"
+
+	var user User
+	err := WithTx(ctx, db, func(q *Queries) error {
+		var err error
+		user, err = q.CreateUser(ctx, CreateUserParams{Email: email, HashedPassword: "x"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	got, err := New(db).GetUserByEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("GetUserByEmail after commit: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("GetUserByEmail returned user %v, want %v", got.ID, user.ID)
+	}
+}
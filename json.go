@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const maxRequestBodyBytes = 1 << 20 // 1 MB
+
+func respondWithError(w http.ResponseWriter, code int, msg string) {
+	if code >= 500 {
+		slog.Error("responding with server error", "status", code, "error", msg)
+	}
+	respondWithJSON(w, code, errorResponse{Error: msg})
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("failed to marshal JSON", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// respondWithJSONArray writes items as a JSON array, encoding one element
+// at a time instead of marshaling the whole slice into a second buffer.
+// Callers still build the full slice, so this only saves that encoded
+// copy, and it lowers the peak rather than the total allocated (see
+// BenchmarkRespondWithJSONArray); maxRowsPerRequest is what bounds the
+// slice itself.
+// The status goes out first, so an encoding failure can only truncate the
+// array; it is logged rather than reported to the client.
+func respondWithJSONArray[T any](w http.ResponseWriter, code int, items []T) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	w.Write([]byte("["))
+	enc := json.NewEncoder(w)
+	for i, item := range items {
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		if err := enc.Encode(item); err != nil {
+			slog.Error("failed to encode JSON array element", "error", err)
+			return
+		}
+	}
+	w.Write([]byte("]"))
+}
+
+// decodeJSON decodes the request body into dst, rejecting fields that dst
+// doesn't declare. On failure it writes the error response itself and
+// returns false, so handlers can simply return.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	return decodeBody(w, r, dst, true)
+}
+
+// decodeJSONAllowUnknown is like decodeJSON but ignores unknown fields. It
+// is meant for third-party payloads whose shape we don't control.
+func decodeJSONAllowUnknown(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	return decodeBody(w, r, dst, false)
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, dst interface{}, strict bool) bool {
+	// Parameters such as "; charset=utf-8" are allowed; only the media type
+	// itself has to be JSON.
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+
+	decoder := json.NewDecoder(r.Body)
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+			return false
+		}
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			respondWithError(w, http.StatusBadRequest, "Unknown field "+field)
+			return false
+		}
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.Is(err, io.EOF):
+			respondWithError(w, http.StatusBadRequest, "Request body is empty")
+		case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+			respondWithError(w, http.StatusBadRequest, "Malformed JSON")
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Field %q has wrong type", typeErr.Field))
+		case errors.As(err, &typeErr):
+			// No field means the top-level value itself is the wrong kind,
+			// such as an array sent to an endpoint that takes an object.
+			switch typeErr.Type.Kind() {
+			case reflect.Slice, reflect.Array:
+				respondWithError(w, http.StatusBadRequest, "Request body must be a JSON array")
+			default:
+				respondWithError(w, http.StatusBadRequest, "Request body must be a JSON object")
+			}
+		default:
+			respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// decodeTestRequest runs decodeJSON against a request with the given
+// content type and body, returning the recorded response and whether
+// decoding succeeded.
+func decodeTestRequest(t *testing.T, contentType, body string, dst interface{}) (*httptest.ResponseRecorder, bool) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	return rec, decodeJSON(rec, req, dst)
+}
+
+// assertErrorResponse checks the status and the errorResponse message.
+func assertErrorResponse(t *testing.T, rec *httptest.ResponseRecorder, status int, msg string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Errorf("status = %d, want %d", rec.Code, status)
+	}
+	var resp errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding error response: %v", err)
+	}
+	if resp.Error != msg {
+		t.Errorf("error = %q, want %q", resp.Error, msg)
+	}
+}
+
+func TestDecodeJSONOversizedBody(t *testing.T) {
+	body := `{"body":"` + strings.Repeat("a", maxRequestBodyBytes) + `"}`
+	var req chirpRequest
+	rec, ok := decodeTestRequest(t, "application/json", body, &req)
+	if ok {
+		t.Fatal("decodeJSON accepted an oversized body")
+	}
+	assertErrorResponse(t, rec, http.StatusRequestEntityTooLarge, "Request body too large")
+}
+
+func TestDecodeJSONUnknownField(t *testing.T) {
+	var req chirpRequest
+	rec, ok := decodeTestRequest(t, "application/json", `{"body":"hi","bdoy":"typo"}`, &req)
+	if ok {
+		t.Fatal("decodeJSON accepted an unknown field")
+	}
+	assertErrorResponse(t, rec, http.StatusBadRequest, `Unknown field "bdoy"`)
+}
+
+func TestDecodeJSONTopLevelTypeMismatch(t *testing.T) {
+	var req chirpRequest
+	rec, ok := decodeTestRequest(t, "application/json", `["hi"]`, &req)
+	if ok {
+		t.Fatal("decodeJSON accepted an array for an object")
+	}
+	assertErrorResponse(t, rec, http.StatusBadRequest, "Request body must be a JSON object")
+
+	var batch []chirpRequest
+	rec, ok = decodeTestRequest(t, "application/json", `{"body":"hi"}`, &batch)
+	if ok {
+		t.Fatal("decodeJSON accepted an object for an array")
+	}
+	assertErrorResponse(t, rec, http.StatusBadRequest, "Request body must be a JSON array")
+}
+
+func TestDecodeJSONFieldTypeMismatch(t *testing.T) {
+	var req chirpRequest
+	rec, ok := decodeTestRequest(t, "application/json", `{"body":42}`, &req)
+	if ok {
+		t.Fatal("decodeJSON accepted a number for a string field")
+	}
+	assertErrorResponse(t, rec, http.StatusBadRequest, `Field "body" has wrong type`)
+}
+
+func TestDecodeJSONAllowUnknownIgnoresExtraFields(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/polka/webhooks", strings.NewReader(`{"body":"hi","extra":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	var dst chirpRequest
+	if !decodeJSONAllowUnknown(rec, req, &dst) {
+		t.Fatalf("decodeJSONAllowUnknown rejected the body: %s", rec.Body)
+	}
+	if dst.Body != "hi" {
+		t.Errorf("Body = %q, want %q", dst.Body, "hi")
+	}
+}
+
+func TestDecodeJSONContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		wantOK      bool
+	}{
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"text/plain", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			var req chirpRequest
+			rec, ok := decodeTestRequest(t, tt.contentType, `{"body":"hi"}`, &req)
+			if ok != tt.wantOK {
+				t.Fatalf("decodeJSON ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !tt.wantOK {
+				assertErrorResponse(t, rec, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			}
+		})
+	}
+}
+
+func benchmarkChirps(n int) []chirp {
+	chirps := make([]chirp, n)
+	for i := range chirps {
+		chirps[i] = chirp{
+			ID:        uuid.New(),
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+			Body:      strings.Repeat("chirp ", 20),
+			UserID:    uuid.New(),
+		}
+	}
+	return chirps
+}
+
+func TestRespondWithJSONArrayMatchesRespondWithJSON(t *testing.T) {
+	chirps := benchmarkChirps(3)
+
+	buffered := httptest.NewRecorder()
+	respondWithJSON(buffered, http.StatusOK, chirps)
+	streamed := httptest.NewRecorder()
+	respondWithJSONArray(streamed, http.StatusOK, chirps)
+
+	var want, got []chirp
+	if err := json.Unmarshal(buffered.Body.Bytes(), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(streamed.Body.Bytes(), &got); err != nil {
+		t.Fatalf("streamed body is not valid JSON: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d chirps, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Body != want[i].Body {
+			t.Errorf("chirp %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRespondWithJSONArrayEmpty(t *testing.T) {
+	rec := httptest.NewRecorder()
+	respondWithJSONArray(rec, http.StatusOK, []chirp{})
+	if got := rec.Body.String(); got != "[]" {
+		t.Errorf("body = %q, want %q", got, "[]")
+	}
+}
+
+// discardResponseWriter throws the body away, the way a network connection
+// does once bytes are sent. httptest.ResponseRecorder would keep the whole
+// body and hide the difference being measured.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+func BenchmarkRespondWithJSON(b *testing.B) {
+	chirps := benchmarkChirps(1000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		respondWithJSON(&discardResponseWriter{header: http.Header{}}, http.StatusOK, chirps)
+	}
+}
+
+func BenchmarkRespondWithJSONArray(b *testing.B) {
+	chirps := benchmarkChirps(1000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		respondWithJSONArray(&discardResponseWriter{header: http.Header{}}, http.StatusOK, chirps)
+	}
+}
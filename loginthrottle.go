@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	maxFailedLogins      = 5
+	loginLockoutDuration = 15 * time.Minute
+	loginAttemptTTL      = 15 * time.Minute
+	loginCleanupInterval = time.Minute
+)
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// loginThrottle tracks failed logins per account and locks an account out
+// for a while once it has too many consecutive failures.
+type loginThrottle struct {
+	mu       sync.Mutex
+	attempts map[string]*loginAttempts
+}
+
+func newLoginThrottle() *loginThrottle {
+	lt := &loginThrottle{
+		attempts: make(map[string]*loginAttempts),
+	}
+	go lt.cleanup()
+	return lt
+}
+
+// locked reports whether email is currently locked out and, if so, how
+// long remains on the lockout.
+func (lt *loginThrottle) locked(email string) (bool, time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	a, ok := lt.attempts[email]
+	if !ok {
+		return false, 0
+	}
+	if remaining := time.Until(a.lockedUntil); remaining > 0 {
+		return true, remaining
+	}
+	return false, 0
+}
+
+func (lt *loginThrottle) recordFailure(email string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	now := time.Now()
+	a, ok := lt.attempts[email]
+	if !ok || now.Sub(a.lastFailure) > loginAttemptTTL {
+		a = &loginAttempts{}
+		lt.attempts[email] = a
+	}
+
+	a.failures++
+	a.lastFailure = now
+	if a.failures >= maxFailedLogins {
+		a.lockedUntil = now.Add(loginLockoutDuration)
+		a.failures = 0
+	}
+}
+
+func (lt *loginThrottle) reset(email string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	delete(lt.attempts, email)
+}
+
+func (lt *loginThrottle) cleanup() {
+	ticker := time.NewTicker(loginCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		lt.mu.Lock()
+		now := time.Now()
+		for email, a := range lt.attempts {
+			if now.After(a.lockedUntil) && now.Sub(a.lastFailure) > loginAttemptTTL {
+				delete(lt.attempts, email)
+			}
+		}
+		lt.mu.Unlock()
+	}
+}
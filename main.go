@@ -1,59 +1,310 @@
 package main
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/mirenk0/chirpy/internal/database"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// Version is the build version, injected at build time with
+// -ldflags "-X main.Version=...".
+var Version = "dev"
+
 type apiConfig struct {
 	fileserverHits atomic.Int32
-	db             *sql.DB
+	apiRequests    atomic.Int32
+	// started is set once main has pinged the database and applied
+	// migrations.
+	started        atomic.Bool
+	db             *database.Queries
+	dbConn         *sql.DB
 	platform       string
+	jwtKeys        jwtKeys
+	jwtAudience    string
+	polkaKey       string
+	corsOrigin     string
+	forbiddenWords []string
+	// rejectedWords get a chirp refused instead of censored.
+	rejectedWords []string
+	// censorReplacement is substituted for each forbidden word.
+	censorReplacement string
+	loginThrottle     *loginThrottle
+	// trustedProxies lists the proxies whose X-Forwarded-For entries
+	// clientIP believes. When empty the header is ignored, since anyone can
+	// send it.
+	trustedProxies []netip.Prefix
+	// minPasswordLength and bcryptCost apply to new and changed passwords.
+	minPasswordLength int
+	bcryptCost        int
+	// chirpStream notifies /api/chirps/stream listeners of new chirps.
+	chirpStream *chirpBroadcaster
+
+	// requireVerifiedEmail blocks posting chirps until the author has
+	// verified their email.
+	requireVerifiedEmail bool
+
+	// When storeClientIP is set, new chirps record an HMAC of the poster's
+	// IP keyed with clientIPSalt, never the raw address.
+	storeClientIP bool
+	clientIPSalt  string
+
+	// maxRowsPerRequest caps every list response, paginated or not.
+	maxRowsPerRequest int
+
+	// Chirpy Red users get the higher of the two length limits.
+	maxChirpLength    int
+	maxChirpLengthRed int
+
+	// Chirps a user may create per chirpQuotaWindow, again with a separate
+	// allowance for Chirpy Red.
+	chirpQuota       int
+	chirpQuotaRed    int
+	chirpQuotaWindow time.Duration
 }
 
-var forbiddenWords = []string{"kerfuffle", "sharbert", "fornax"}
+var defaultForbiddenWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+const defaultCensorReplacement = "****"
+
+// deletedAuthorPlaceholder stands in for the email of an author who no
+// longer exists when chirps are listed with ?include=author.
+const deletedAuthorPlaceholder = "[deleted]"
+
+const (
+	defaultMaxChirpLength    = 140
+	defaultMaxChirpLengthRed = 280
+)
+
+// idempotencyKeyTTL is how long an Idempotency-Key on POST /api/chirps keeps
+// replaying the chirp it created.
+const idempotencyKeyTTL = 24 * time.Hour
+
+// errIdempotencyKeyTaken aborts a chirp insert whose Idempotency-Key another
+// request claimed first.
+var errIdempotencyKeyTaken = errors.New("idempotency key already claimed")
+
+const (
+	defaultChirpQuota       = 100
+	defaultChirpQuotaRed    = 500
+	defaultChirpQuotaWindow = 24 * time.Hour
+)
+
+const (
+	defaultChirpsLimit = 50
+	maxChirpsLimit     = 100 // default for MAX_ROWS_PER_REQUEST
+	maxBulkChirps      = 100
+	maxBatchUserIDs    = 100
+)
+
+const (
+	// exportPageSize is how many chirps the export reads per query.
+	exportPageSize = 500
+	// exportWriteTimeout is the write deadline granted per page, so a
+	// large export isn't cut off by the server-wide WriteTimeout.
+	exportWriteTimeout = 30 * time.Second
+)
+
+const (
+	shutdownTimeout = 10 * time.Second
+	dbPingTimeout   = 2 * time.Second
+	// dbQueryTimeout bounds the database work done by a single request.
+	// It is derived from the request context, so a client disconnect
+	// cancels in-flight queries as well.
+	dbQueryTimeout = 5 * time.Second
+)
+
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 10 * time.Second
+	defaultWriteTimeout      = 10 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+)
 
-const maxChirpLength = 140
+const (
+	defaultDBMaxOpenConns    = 25
+	defaultDBMaxIdleConns    = 25
+	defaultDBConnMaxLifetime = 5 * time.Minute
+)
 
 type chirpRequest struct {
-	Body string `json:"body"`
+	Body     string     `json:"body"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+type userRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// createUserRequest is the sign-up body. Only sign-up takes a username, so
+// PUT /api/users keeps rejecting it as an unknown field.
+type createUserRequest struct {
+	userRequest
+	// Username is optional.
+	Username string `json:"username,omitempty"`
 }
 
 type errorResponse struct {
 	Error string `json:"error"`
 }
 
+type validationErrorResponse struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields"`
+}
+
 type successResponse struct {
 	CleanedBody string `json:"cleaned_body"`
 }
 
+type chirp struct {
+	ID       uuid.UUID  `json:"id"`
+	Body     string     `json:"body"`
+	UserID   uuid.UUID  `json:"user_id"`
+	ParentID *uuid.UUID `json:"parent_id,omitempty"`
+	// AuthorEmail is only filled in for ?include=author.
+	AuthorEmail *string     `json:"author_email,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	DeletedAt   *time.Time  `json:"deleted_at,omitempty"`
+	LikeCount   int64       `json:"like_count"`
+	Mentions    []uuid.UUID `json:"mentions"`
+	CharCount   *int        `json:"char_count,omitempty"`
+	WordCount   *int        `json:"word_count,omitempty"`
+}
+
+// withStats fills in the optional character and word counts.
+func (c chirp) withStats() chirp {
+	charCount := utf8.RuneCountInString(c.Body)
+	wordCount := 0
+	for _, word := range splitWords(c.Body) {
+		if word != "" {
+			wordCount++
+		}
+	}
+	c.CharCount = &charCount
+	c.WordCount = &wordCount
+	return c
+}
+
 type user struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uuid.UUID `json:"id"`
+	Email         string    `json:"email"`
+	Username      string    `json:"username,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+}
+
+type publicUser struct {
+	ID          uuid.UUID `json:"id"`
+	Email       string    `json:"email"`
+	Username    string    `json:"username,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+// userProfile is what anyone can see about a user looked up by username.
+// Unlike publicUser it leaves out the email address.
+type userProfile struct {
+	ID          uuid.UUID `json:"id"`
+	Username    string    `json:"username"`
+	CreatedAt   time.Time `json:"created_at"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+type batchUsersRequest struct {
+	IDs []uuid.UUID `json:"ids"`
+}
+
+type adminUser struct {
+	ID          uuid.UUID `json:"id"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ChirpCount  int64     `json:"chirp_count"`
+}
+
+type reportRequest struct {
+	Reason string `json:"reason"`
+}
+
+type reportedChirp struct {
+	ChirpID        uuid.UUID `json:"chirp_id"`
+	Body           string    `json:"body"`
+	ReportCount    int64     `json:"report_count"`
+	LastReportedAt time.Time `json:"last_reported_at"`
+}
+
+type debugHealthResponse struct {
+	DBReachable    bool    `json:"db_reachable"`
+	DBPingMS       float64 `json:"db_ping_ms"`
+	DBError        string  `json:"db_error,omitempty"`
+	FileserverHits int32   `json:"fileserver_hits"`
+	Goroutines     int     `json:"goroutines"`
+	Memory         struct {
+		AllocBytes      uint64 `json:"alloc_bytes"`
+		TotalAllocBytes uint64 `json:"total_alloc_bytes"`
+		SysBytes        uint64 `json:"sys_bytes"`
+		HeapObjects     uint64 `json:"heap_objects"`
+		NumGC           uint32 `json:"num_gc"`
+	} `json:"memory"`
+}
+
+type countResponse struct {
+	Count int64 `json:"count"`
+}
+
+type resetResponse struct {
+	UsersDeleted  int64 `json:"users_deleted"`
+	ChirpsDeleted int64 `json:"chirps_deleted"`
+	DryRun        bool  `json:"dry_run,omitempty"`
+}
+
+type loginResponse struct {
+	user
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 func main() {
 	err := godotenv.Load()
 	if err != nil {
-		fmt.Println("Warning: Could not load .env file")
+		slog.Warn("could not load .env file")
 	}
 
 	// Get environment variables
 	dbURL := os.Getenv("DB_URL")
 	if dbURL == "" {
-		fmt.Println("Error: DB_URL not set in environment")
+		slog.Error("DB_URL not set in environment")
 		return
 	}
 
@@ -62,67 +313,483 @@ func main() {
 		platform = "prod" // Default to production if not set
 	}
 
-	// Open database connection
-	db, err := sql.Open("postgres", dbURL)
+	// JWT_SECRETS (a JSON map of kid to secret, with JWT_KEY_ID naming the
+	// signing key) takes precedence over a single JWT_SECRET.
+	var keys jwtKeys
+	if secretsJSON := os.Getenv("JWT_SECRETS"); secretsJSON != "" {
+		keys, err = parseJWTKeys(secretsJSON, os.Getenv("JWT_KEY_ID"))
+		if err != nil {
+			slog.Error("invalid JWT_SECRETS", "error", err)
+			return
+		}
+	} else {
+		jwtSecret := os.Getenv("JWT_SECRET")
+		if jwtSecret == "" {
+			slog.Error("JWT_SECRET not set in environment")
+			return
+		}
+		keys = singleJWTKey(jwtSecret)
+	}
+
+	// JWT_AUDIENCE names the client app this deployment serves. Tokens
+	// minted for a different audience are rejected.
+	jwtAudience := os.Getenv("JWT_AUDIENCE")
+
+	polkaKey := os.Getenv("POLKA_KEY")
+	if polkaKey == "" {
+		slog.Error("POLKA_KEY not set in environment")
+		return
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080" // Default port if not set
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		slog.Error("PORT must be a number between 0 and 65535", "port", port)
+		return
+	}
+
+	// TLS is enabled only when both files are given; one without the other
+	// is almost certainly a misconfiguration.
+	tlsCertFile := os.Getenv("TLS_CERT_FILE")
+	tlsKeyFile := os.Getenv("TLS_KEY_FILE")
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		slog.Error("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		return
+	}
+	useTLS := tlsCertFile != ""
+
+	corsOrigin := os.Getenv("CORS_ORIGIN")
+	if corsOrigin == "" {
+		corsOrigin = "*" // Allow any origin if not set
+	}
+
+	forbiddenWords := defaultForbiddenWords
+	if v := os.Getenv("FORBIDDEN_WORDS"); v != "" {
+		forbiddenWords = parseForbiddenWords(v)
+	}
+
+	// MODERATION_RULES layers per-word actions on top of FORBIDDEN_WORDS:
+	// "replace" words are censored like forbidden ones, and "reject" words
+	// get the whole chirp refused with a 400.
+	var rejectedWords []string
+	if v := os.Getenv("MODERATION_RULES"); v != "" {
+		replaceWords, rejectWords, err := parseModerationRules(v)
+		if err != nil {
+			slog.Error("invalid MODERATION_RULES", "error", err)
+			return
+		}
+		forbiddenWords = append(forbiddenWords, replaceWords...)
+		rejectedWords = rejectWords
+	}
+
+	// With no mail transport, the verification link only reaches anyone
+	// through the dev log, so elsewhere nobody could ever verify and post.
+	requireVerifiedEmail := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	if requireVerifiedEmail && platform != "dev" {
+		slog.Error("REQUIRE_VERIFIED_EMAIL needs a mail transport and is only supported on the dev platform")
+		return
+	}
+
+	storeClientIP := os.Getenv("STORE_CLIENT_IP") == "true"
+	clientIPSalt := os.Getenv("CLIENT_IP_SALT")
+	if storeClientIP && clientIPSalt == "" {
+		slog.Error("CLIENT_IP_SALT must be set when STORE_CLIENT_IP is enabled")
+		return
+	}
+
+	censorReplacement := os.Getenv("CENSOR_REPLACEMENT")
+	if censorReplacement == "" {
+		censorReplacement = defaultCensorReplacement
+	}
+
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUST_PROXY"))
+	if err != nil {
+		slog.Error("TRUST_PROXY must be a comma-separated list of IPs or CIDRs", "error", err)
+		return
+	}
+
+	rateLimitPerMinute, err := getEnvInt("RATE_LIMIT_PER_MINUTE", defaultRateLimitPerMinute)
+	if err != nil || rateLimitPerMinute <= 0 {
+		slog.Error("RATE_LIMIT_PER_MINUTE must be a positive integer")
+		return
+	}
+
+	maxRowsPerRequest, err := getEnvInt("MAX_ROWS_PER_REQUEST", maxChirpsLimit)
+	if err != nil || maxRowsPerRequest <= 0 || maxRowsPerRequest > math.MaxInt32 {
+		slog.Error("MAX_ROWS_PER_REQUEST must be a positive integer")
+		return
+	}
+
+	maxChirpLength, err := getEnvInt("MAX_CHIRP_LENGTH", defaultMaxChirpLength)
+	if err != nil || maxChirpLength <= 0 {
+		slog.Error("MAX_CHIRP_LENGTH must be a positive integer")
+		return
+	}
+
+	maxChirpLengthRed, err := getEnvInt("MAX_CHIRP_LENGTH_RED", defaultMaxChirpLengthRed)
+	if err != nil || maxChirpLengthRed <= 0 {
+		slog.Error("MAX_CHIRP_LENGTH_RED must be a positive integer")
+		return
+	}
+
+	chirpQuota, err := getEnvInt("CHIRP_QUOTA", defaultChirpQuota)
+	if err != nil || chirpQuota <= 0 {
+		slog.Error("CHIRP_QUOTA must be a positive integer")
+		return
+	}
+
+	chirpQuotaRed, err := getEnvInt("CHIRP_QUOTA_RED", defaultChirpQuotaRed)
+	if err != nil || chirpQuotaRed <= 0 {
+		slog.Error("CHIRP_QUOTA_RED must be a positive integer")
+		return
+	}
+
+	chirpQuotaWindow, err := getEnvDuration("CHIRP_QUOTA_WINDOW", defaultChirpQuotaWindow)
+	if err != nil || chirpQuotaWindow <= 0 {
+		slog.Error("CHIRP_QUOTA_WINDOW must be a positive duration")
+		return
+	}
+
+	minPasswordLength, err := getEnvInt("MIN_PASSWORD_LENGTH", defaultMinPasswordLength)
+	if err != nil || minPasswordLength <= 0 {
+		slog.Error("MIN_PASSWORD_LENGTH must be a positive integer")
+		return
+	}
+
+	bcryptCost, err := getEnvInt("BCRYPT_COST", bcrypt.DefaultCost)
+	if err != nil || bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		slog.Error("BCRYPT_COST out of range", "min", bcrypt.MinCost, "max", bcrypt.MaxCost)
+		return
+	}
+	slog.Info("using bcrypt cost", "cost", bcryptCost)
+
+	maxOpenConns, err := getEnvInt("DB_MAX_OPEN_CONNS", defaultDBMaxOpenConns)
+	if err != nil || maxOpenConns < 0 {
+		slog.Error("DB_MAX_OPEN_CONNS must be a non-negative integer")
+		return
+	}
+
+	maxIdleConns, err := getEnvInt("DB_MAX_IDLE_CONNS", defaultDBMaxIdleConns)
+	if err != nil || maxIdleConns < 0 {
+		slog.Error("DB_MAX_IDLE_CONNS must be a non-negative integer")
+		return
+	}
+
+	connMaxLifetime, err := getEnvDuration("DB_CONN_MAX_LIFETIME", defaultDBConnMaxLifetime)
+	if err != nil || connMaxLifetime < 0 {
+		slog.Error("DB_CONN_MAX_LIFETIME must be a non-negative duration")
+		return
+	}
+
+	readHeaderTimeout, err := getEnvDuration("SERVER_READ_HEADER_TIMEOUT", defaultReadHeaderTimeout)
+	if err != nil || readHeaderTimeout <= 0 {
+		slog.Error("SERVER_READ_HEADER_TIMEOUT must be a positive duration")
+		return
+	}
+
+	readTimeout, err := getEnvDuration("SERVER_READ_TIMEOUT", defaultReadTimeout)
+	if err != nil || readTimeout <= 0 {
+		slog.Error("SERVER_READ_TIMEOUT must be a positive duration")
+		return
+	}
+
+	writeTimeout, err := getEnvDuration("SERVER_WRITE_TIMEOUT", defaultWriteTimeout)
+	if err != nil || writeTimeout <= 0 {
+		slog.Error("SERVER_WRITE_TIMEOUT must be a positive duration")
+		return
+	}
+
+	idleTimeout, err := getEnvDuration("SERVER_IDLE_TIMEOUT", defaultIdleTimeout)
+	if err != nil || idleTimeout <= 0 {
+		slog.Error("SERVER_IDLE_TIMEOUT must be a positive duration")
+		return
+	}
+
+	// Open database connection. The columns are TIMESTAMP without a zone
+	// and are filled by NOW(), so the session is pinned to UTC to match the
+	// UTC times the handlers pass in.
+	db, err := sql.Open("postgres", withDSNParam(dbURL, "timezone", "UTC"))
 	if err != nil {
-		fmt.Println("Error connecting to database:", err)
+		slog.Error("failed to open database", "error", err)
 		return
 	}
 	defer db.Close()
 
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+	db.SetConnMaxLifetime(connMaxLifetime)
+
 	mux := http.NewServeMux()
-	apiCfg := &apiConfig{db: db, platform: platform}
+	limiter := newRateLimiter(rateLimitPerMinute, trustedProxies)
+	apiCfg := &apiConfig{
+		db:                database.New(db),
+		dbConn:            db,
+		platform:          platform,
+		jwtKeys:           keys,
+		jwtAudience:       jwtAudience,
+		polkaKey:          polkaKey,
+		corsOrigin:        corsOrigin,
+		forbiddenWords:    forbiddenWords,
+		rejectedWords:     rejectedWords,
+		censorReplacement: censorReplacement,
+		loginThrottle:     newLoginThrottle(),
+		chirpStream:       newChirpBroadcaster(),
+		trustedProxies:    trustedProxies,
+		minPasswordLength: minPasswordLength,
+		bcryptCost:        bcryptCost,
+
+		requireVerifiedEmail: requireVerifiedEmail,
+
+		storeClientIP: storeClientIP,
+		clientIPSalt:  clientIPSalt,
+
+		maxRowsPerRequest: maxRowsPerRequest,
+
+		maxChirpLength:    maxChirpLength,
+		maxChirpLengthRed: maxChirpLengthRed,
+
+		chirpQuota:       chirpQuota,
+		chirpQuotaRed:    chirpQuotaRed,
+		chirpQuotaWindow: chirpQuotaWindow,
+	}
 
+	// GET patterns also match HEAD, and net/http drops the body of a HEAD
+	// response, so every read endpoint answers probes with the same status
+	// and headers without any extra registration.
 	mux.HandleFunc("GET /api/healthz", readinessHandler)
 
+	mux.HandleFunc("GET /api/version", versionHandler)
+
+	mux.HandleFunc("GET /api/openapi.json", openAPIHandler)
+
+	mux.HandleFunc("GET /api/ready", apiCfg.dbReadinessHandler)
+
+	mux.HandleFunc("GET /api/startup", apiCfg.startupHandler)
+
+	mux.HandleFunc("GET /debug/health", apiCfg.debugHealthHandler)
+
 	fileServer := http.FileServer(http.Dir("."))
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", fileServer)))
 
 	mux.HandleFunc("GET /admin/metrics", apiCfg.metricsHandler)
 
+	mux.HandleFunc("GET /api/metrics", apiCfg.metricsJSONHandler)
+
+	mux.HandleFunc("GET /metrics", apiCfg.prometheusMetricsHandler)
+
 	mux.HandleFunc("POST /admin/reset", apiCfg.resetHandler)
 
+	mux.HandleFunc("GET /admin/users", apiCfg.adminListUsersHandler)
+
+	mux.HandleFunc("GET /admin/reports", apiCfg.adminListReportsHandler)
+
+	mux.HandleFunc("GET /admin/chirps/{chirpID}/same-ip", apiCfg.adminSameIPChirpsHandler)
+
 	mux.Handle("/assets/logo.png", fileServer)
 
-	mux.HandleFunc("POST /api/validate_chirp", chirpValidateHandler)
+	mux.HandleFunc("POST /api/validate_chirp", apiCfg.chirpValidateHandler)
 
 	mux.HandleFunc("POST /api/users", apiCfg.createUserHandler)
 
+	mux.HandleFunc("PUT /api/users", apiCfg.updateUserHandler)
+
+	mux.HandleFunc("DELETE /api/users", apiCfg.deleteUserHandler)
+
+	mux.HandleFunc("GET /api/users/me", apiCfg.getCurrentUserHandler)
+
+	mux.HandleFunc("GET /api/verify", apiCfg.verifyEmailHandler)
+
+	mux.HandleFunc("GET /api/users/{userID}", apiCfg.getUserHandler)
+	mux.HandleFunc("GET /api/users/by-username/{username}", apiCfg.getUserByUsernameHandler)
+	mux.HandleFunc("POST /api/users/batch", apiCfg.batchGetUsersHandler)
+
+	mux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.followUserHandler)
+
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.unfollowUserHandler)
+
+	mux.HandleFunc("GET /api/feed", apiCfg.feedHandler)
+
+	mux.Handle("POST /api/login", limiter.middleware(http.HandlerFunc(apiCfg.loginHandler)))
+
+	mux.HandleFunc("POST /api/refresh", apiCfg.refreshHandler)
+
+	mux.HandleFunc("POST /api/revoke", apiCfg.revokeHandler)
+
+	mux.Handle("POST /api/chirps", limiter.middleware(http.HandlerFunc(apiCfg.createChirpHandler)))
+
+	mux.Handle("POST /api/chirps/bulk", limiter.middleware(http.HandlerFunc(apiCfg.bulkCreateChirpsHandler)))
+
+	mux.HandleFunc("GET /api/chirps", apiCfg.getChirpsHandler)
+
+	mux.HandleFunc("GET /api/chirps/search", apiCfg.searchChirpsHandler)
+
+	mux.HandleFunc("GET /api/chirps/count", apiCfg.countChirpsHandler)
+
+	mux.HandleFunc("GET /api/chirps/random", apiCfg.randomChirpHandler)
+
+	mux.HandleFunc("GET /api/chirps/export", apiCfg.exportChirpsHandler)
+
+	mux.HandleFunc("GET /api/chirps/stream", apiCfg.streamChirpsHandler)
+
+	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirpHandler)
+
+	mux.HandleFunc("GET /api/chirps/{chirpID}/replies", apiCfg.getChirpRepliesHandler)
+
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", apiCfg.likeChirpHandler)
+
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", apiCfg.unlikeChirpHandler)
+
+	mux.HandleFunc("POST /api/chirps/{chirpID}/report", apiCfg.reportChirpHandler)
+
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.updateChirpHandler)
+
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirpHandler)
+
+	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.polkaWebhookHandler)
+
+	// Middleware is applied inside out; middlewareRecover must stay
+	// outermost so it catches panics from everything below it.
+	var handler http.Handler = mux
+	handler = apiCfg.middlewareGzip(handler)
+	handler = apiCfg.middlewareCORS(handler)
+	handler = apiCfg.middlewareRequestsInc(handler)
+	handler = apiCfg.middlewareLog(handler)
+	handler = apiCfg.middlewareRequestID(handler)
+	handler = apiCfg.middlewareRecover(handler)
+
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
 	}
+	server.RegisterOnShutdown(apiCfg.chirpStream.close)
+	slog.Info("server timeouts",
+		"read_header", readHeaderTimeout,
+		"read", readTimeout,
+		"write", writeTimeout,
+		"idle", idleTimeout,
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		var err error
+		if useTLS {
+			slog.Info("starting server", "addr", server.Addr, "tls", true)
+			err = server.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+		} else {
+			slog.Info("starting server", "addr", server.Addr, "tls", false)
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
 
-	fmt.Println("Starting server on :8080...")
-	err = server.ListenAndServe()
+	// The listener comes up before the database is checked so that a
+	// startup probe can see the server initializing; /api/startup reports
+	// 503 until the ping and migrations below have succeeded.
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), dbPingTimeout)
+	err = db.PingContext(pingCtx)
+	cancelPing()
 	if err != nil {
-		fmt.Println("Error starting server:", err)
+		slog.Error("database is unreachable", "db_reachable", false, "error", err)
+		return
+	}
+
+	if err := runMigrations(db); err != nil {
+		slog.Error("failed to run migrations", "error", err)
+		return
+	}
+
+	slog.Info("chirpy starting",
+		"version", Version,
+		"platform", platform,
+		"port", port,
+		"db_reachable", true,
+	)
+	apiCfg.started.Store(true)
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			slog.Error("server failed", "error", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to shut down server", "error", err)
+		return
+	}
+	slog.Info("server shutdown complete")
+}
+
+// getEnvInt returns the integer value of the environment variable key, or
+// fallback if it is unset.
+func getEnvInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// withDSNParam sets a connection parameter on either form of Postgres DSN,
+// a postgres:// URL or a list of key=value pairs.
+func withDSNParam(dsn, key, value string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		q := u.Query()
+		q.Set(key, value)
+		u.RawQuery = q.Encode()
+		return u.String()
 	}
+	return dsn + " " + key + "=" + value
 }
 
-func chirpValidateHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// getEnvDuration returns the duration value (e.g. "30s") of the environment
+// variable key, or fallback if it is unset.
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(v)
+}
 
+func (cfg *apiConfig) chirpValidateHandler(w http.ResponseWriter, r *http.Request) {
 	var req chirpRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		resp, _ := json.Marshal(errorResponse{Error: "Invalid request body"})
-		w.Write(resp)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	if len(req.Body) > maxChirpLength {
-		w.WriteHeader(http.StatusBadRequest)
-		resp, _ := json.Marshal(errorResponse{Error: "Chirp is too long"})
-		w.Write(resp)
+	if errs := validateChirpRequest(req, cfg.maxChirpLength, cfg.rejectedWords); !errs.ok() {
+		respondWithValidationErrors(w, errs)
 		return
 	}
 
-	cleanedBody := censorText(req.Body, forbiddenWords)
+	cleanedBody := censorText(normalizeChirpBody(req.Body), cfg.forbiddenWords, cfg.censorReplacement)
 
-	w.WriteHeader(http.StatusOK)
-	resp, _ := json.Marshal(successResponse{CleanedBody: cleanedBody})
-	w.Write(resp)
+	respondWithJSON(w, http.StatusOK, successResponse{CleanedBody: cleanedBody})
+}
+
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, struct {
+		Version string `json:"version"`
+	}{Version: Version})
 }
 
 func readinessHandler(w http.ResponseWriter, r *http.Request) {
@@ -131,91 +798,2313 @@ func readinessHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK\n"))
 }
 
-func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits.Add(1)
-		next.ServeHTTP(w, r)
-	})
-}
-
-func censorText(text string, words []string) string {
-	wordsInText := strings.Split(text, " ")
+// dbReadinessHandler reports whether the server can take traffic: startup
+// has finished and the database answers a ping. Until migrations have been
+// applied the schema may not match the code, so it stays 503 even if the
+// database is reachable.
+func (cfg *apiConfig) dbReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
-	for i, word := range wordsInText {
-		lowerWord := strings.ToLower(word)
-		for _, forbidden := range words {
-			if lowerWord == forbidden {
-				wordsInText[i] = "****"
-				break
-			}
-		}
+	if !cfg.started.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("Starting\n"))
+		return
 	}
 
-	return strings.Join(wordsInText, " ")
-}
+	ctx, cancel := context.WithTimeout(r.Context(), dbPingTimeout)
+	defer cancel()
+
+	if err := cfg.dbConn.PingContext(ctx); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("Database unavailable\n"))
+		return
+	}
 
-func (cfg *apiConfig) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	count := cfg.fileserverHits.Load()
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `<!DOCTYPE html>
-<html>
-  <head>
-    <title>Chirpy Metrics</title>
-  </head>
-  <body>
-    <h1>Welcome, Chirpy Admin</h1>
-    <p>Chirpy has been visited %d times!</p>
-  </body>
-</html>`, count)
+	w.Write([]byte("OK\n"))
 }
 
-func (cfg *apiConfig) resetHandler(w http.ResponseWriter, r *http.Request) {
+// debugHealthHandler reports process and database details for diagnosis.
+// It is dev only, since goroutine and memory figures are nobody else's
+// business.
+func (cfg *apiConfig) debugHealthHandler(w http.ResponseWriter, r *http.Request) {
 	if cfg.platform != "dev" {
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(errorResponse{Error: "Forbidden"})
+		respondWithError(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
-	cfg.fileserverHits.Store(0)
-	_, err := cfg.db.Exec("DELETE FROM users")
+	ctx, cancel := context.WithTimeout(r.Context(), dbPingTimeout)
+	defer cancel()
+
+	var resp debugHealthResponse
+	start := time.Now()
+	err := cfg.dbConn.PingContext(ctx)
+	resp.DBPingMS = float64(time.Since(start).Microseconds()) / 1000
+	resp.DBReachable = err == nil
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(errorResponse{Error: "Failed to reset users"})
-		return
+		resp.DBError = err.Error()
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Counter reset and users deleted\n"))
-}
+	resp.FileserverHits = cfg.fileserverHits.Load()
+	resp.Goroutines = runtime.NumGoroutine()
 
-func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	resp.Memory.AllocBytes = mem.Alloc
+	resp.Memory.TotalAllocBytes = mem.TotalAlloc
+	resp.Memory.SysBytes = mem.Sys
+	resp.Memory.HeapObjects = mem.HeapObjects
+	resp.Memory.NumGC = mem.NumGC
 
-	var req struct {
-		Email string `json:"email"`
+	status := http.StatusOK
+	if !resp.DBReachable {
+		status = http.StatusServiceUnavailable
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(errorResponse{Error: "Invalid request body"})
+	respondWithJSON(w, status, resp)
+}
+
+// startupHandler is meant for startup probes: unlike /api/ready it doesn't
+// touch the database, it only reports whether initialization has finished.
+func (cfg *apiConfig) startupHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if !cfg.started.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("Starting\n"))
 		return
 	}
 
-	newUser := user{
-		ID:        uuid.New().String(),
-		Email:     req.Email,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK\n"))
+}
+
+func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.fileserverHits.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cfg *apiConfig) middlewareRequestsInc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.apiRequests.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseForbiddenWords splits a comma-separated list into lowercase words,
+// skipping empty entries.
+func parseForbiddenWords(list string) []string {
+	var words []string
+	for _, word := range strings.Split(list, ",") {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// Actions accepted in MODERATION_RULES.
+const (
+	moderationReplace = "replace"
+	moderationReject  = "reject"
+)
+
+// parseModerationRules reads a JSON object of word to action, as
+// configured by MODERATION_RULES, and splits it into the words to censor
+// and the words to reject. Words are lowercased like FORBIDDEN_WORDS.
+func parseModerationRules(rulesJSON string) (replace, reject []string, err error) {
+	var rules map[string]string
+	if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	for word, action := range rules {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" {
+			return nil, nil, errors.New("empty word")
+		}
+		switch action {
+		case moderationReplace:
+			replace = append(replace, word)
+		case moderationReject:
+			reject = append(reject, word)
+		default:
+			return nil, nil, fmt.Errorf("unknown action %q for %q", action, word)
+		}
+	}
+	return replace, reject, nil
+}
+
+func splitWords(text string) []string {
+	return strings.Split(text, " ")
+}
+
+func censorText(text string, words []string, replacement string) string {
+	wordsInText := splitWords(text)
+
+	for i, word := range wordsInText {
+		// Compare without surrounding punctuation so "Sharbert!" still
+		// matches, but keep the punctuation in the output.
+		core := strings.TrimFunc(word, unicode.IsPunct)
+		if core == "" {
+			continue
+		}
+		start := strings.Index(word, core)
+		prefix, suffix := word[:start], word[start+len(core):]
+
+		lowerWord := strings.ToLower(core)
+		for _, forbidden := range words {
+			if lowerWord == forbidden {
+				wordsInText[i] = prefix + replacement + suffix
+				break
+			}
+		}
+	}
+
+	return strings.Join(wordsInText, " ")
+}
+
+// containsWord reports whether text contains any of words, matched the same
+// way censorText matches them.
+func containsWord(text string, words []string) bool {
+	for _, word := range splitWords(text) {
+		core := strings.ToLower(strings.TrimFunc(word, unicode.IsPunct))
+		if core == "" {
+			continue
+		}
+		for _, candidate := range words {
+			if core == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseMentions returns the lowercased usernames written as @username in
+// text, in order of first appearance and without duplicates. Trailing
+// punctuation is ignored so that "@alice," still counts.
+func parseMentions(text string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, word := range splitWords(text) {
+		name, ok := strings.CutPrefix(word, "@")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimRightFunc(name, func(r rune) bool {
+			return r != '_' && unicode.IsPunct(r)
+		}))
+		if !isValidUsername(name) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		usernames = append(usernames, name)
+	}
+	return usernames
+}
+
+// saveMentions records the users mentioned in body against the chirp and
+// returns their IDs. Mentions of usernames nobody has are ignored.
+func saveMentions(ctx context.Context, q *database.Queries, chirpID uuid.UUID, body string) ([]uuid.UUID, error) {
+	mentions := []uuid.UUID{}
+	usernames := parseMentions(body)
+	if len(usernames) == 0 {
+		return mentions, nil
+	}
+
+	userIDs, err := q.GetUserIDsByUsernames(ctx, usernames)
+	if err != nil {
+		return nil, err
+	}
+	for _, userID := range userIDs {
+		err := q.CreateChirpMention(ctx, database.CreateChirpMentionParams{
+			ChirpID: chirpID,
+			UserID:  userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, userID)
+	}
+	return mentions, nil
+}
+
+func (cfg *apiConfig) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	count := cfg.fileserverHits.Load()
+	requests := cfg.apiRequests.Load()
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+  <head>
+    <title>Chirpy Metrics</title>
+  </head>
+  <body>
+    <h1>Welcome, Chirpy Admin</h1>
+    <p>Chirpy has been visited %d times!</p>
+    <p>API requests: %d</p>
+  </body>
+</html>`, count, requests)
+}
+
+func (cfg *apiConfig) metricsJSONHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	users, err := cfg.db.CountUsers(ctx)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count users")
+		return
+	}
+
+	chirps, err := cfg.db.CountChirps(ctx, database.CountChirpsParams{})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count chirps")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		FileserverHits int32 `json:"fileserver_hits"`
+		APIRequests    int32 `json:"api_requests"`
+		Users          int64 `json:"users"`
+		Chirps         int64 `json:"chirps"`
+	}{
+		FileserverHits: cfg.fileserverHits.Load(),
+		APIRequests:    cfg.apiRequests.Load(),
+		Users:          users,
+		Chirps:         chirps,
+	})
+}
+
+func (cfg *apiConfig) prometheusMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	users, err := cfg.db.CountUsers(ctx)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count users")
+		return
+	}
+
+	chirps, err := cfg.db.CountChirps(ctx, database.CountChirpsParams{})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count chirps")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `# HELP chirpy_fileserver_hits_total Number of requests served by the /app/ fileserver.
+# TYPE chirpy_fileserver_hits_total counter
+chirpy_fileserver_hits_total %d
+# HELP chirpy_api_requests_total Number of HTTP requests handled.
+# TYPE chirpy_api_requests_total counter
+chirpy_api_requests_total %d
+# HELP chirpy_users_total Number of registered users.
+# TYPE chirpy_users_total gauge
+chirpy_users_total %d
+# HELP chirpy_chirps_total Number of stored chirps.
+# TYPE chirpy_chirps_total gauge
+chirpy_chirps_total %d
+`, cfg.fileserverHits.Load(), cfg.apiRequests.Load(), users, chirps)
+}
+
+func (cfg *apiConfig) resetHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	if cfg.platform != "dev" {
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	// A dry run reports what a reset would delete and leaves everything,
+	// metrics included, untouched.
+	if r.URL.Query().Get("dry_run") == "true" {
+		chirps, err := cfg.db.CountAllChirps(ctx)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to count chirps")
+			return
+		}
+
+		users, err := cfg.db.CountUsers(ctx)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to count users")
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, resetResponse{
+			UsersDeleted:  users,
+			ChirpsDeleted: chirps,
+			DryRun:        true,
+		})
+		return
+	}
+
+	slog.Info("admin reset", "time", time.Now().UTC().Format(time.RFC3339), "remote_addr", clientIP(r, cfg.trustedProxies))
+
+	// Chirps would be removed by the cascade anyway, but deleting them
+	// first lets us report how many went. Both deletes share a transaction
+	// so a failure can't leave the database half reset.
+	var chirpsDeleted, usersDeleted int64
+	err := database.WithTx(ctx, cfg.dbConn, func(q *database.Queries) error {
+		var err error
+		chirpsDeleted, err = q.DeleteAllChirps(ctx)
+		if err != nil {
+			return err
+		}
+		usersDeleted, err = q.DeleteAllUsers(ctx)
+		return err
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to reset database")
+		return
+	}
+
+	cfg.fileserverHits.Store(0)
+	cfg.apiRequests.Store(0)
+
+	respondWithJSON(w, http.StatusOK, resetResponse{
+		UsersDeleted:  usersDeleted,
+		ChirpsDeleted: chirpsDeleted,
+	})
+}
+
+func (cfg *apiConfig) adminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	if cfg.platform != "dev" {
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	limit, offset := cfg.parsePagination(r)
+	w.Header().Set("X-Limit", strconv.Itoa(int(limit)))
+	w.Header().Set("X-Offset", strconv.Itoa(int(offset)))
+
+	rows, err := cfg.db.ListUsersWithChirpCounts(ctx, database.ListUsersWithChirpCountsParams{
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve users")
+		return
+	}
+
+	users := []adminUser{}
+	for _, row := range rows {
+		users = append(users, adminUser{
+			ID:          row.ID,
+			Email:       row.Email,
+			CreatedAt:   row.CreatedAt.UTC(),
+			IsChirpyRed: row.IsChirpyRed,
+			ChirpCount:  row.ChirpCount,
+		})
+	}
+
+	respondWithJSONArray(w, http.StatusOK, users)
+}
+
+func (cfg *apiConfig) adminListReportsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	if cfg.platform != "dev" {
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	limit, offset := cfg.parsePagination(r)
+	w.Header().Set("X-Limit", strconv.Itoa(int(limit)))
+	w.Header().Set("X-Offset", strconv.Itoa(int(offset)))
+
+	rows, err := cfg.db.ListReportedChirps(ctx, database.ListReportedChirpsParams{
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve reports")
+		return
+	}
+
+	reports := []reportedChirp{}
+	for _, row := range rows {
+		reports = append(reports, reportedChirp{
+			ChirpID:        row.ChirpID,
+			Body:           row.Body,
+			ReportCount:    row.ReportCount,
+			LastReportedAt: row.LastReportedAt.UTC(),
+		})
+	}
+
+	respondWithJSONArray(w, http.StatusOK, reports)
+}
+
+// adminSameIPChirpsHandler lists chirps posted from the same hashed IP as
+// the given chirp, deleted ones included, to help spot coordinated spam.
+func (cfg *apiConfig) adminSameIPChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	if cfg.platform != "dev" {
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirpByIDIncludingDeleted(ctx, chirpID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+		return
+	}
+
+	if !dbChirp.ClientIpHash.Valid {
+		respondWithError(w, http.StatusNotFound, "No client IP recorded for chirp")
+		return
+	}
+
+	dbChirps, err := cfg.db.GetChirpsByClientIPHash(ctx, database.GetChirpsByClientIPHashParams{
+		ClientIpHash: dbChirp.ClientIpHash,
+		Limit:        int32(cfg.maxRowsPerRequest),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+		return
+	}
+
+	chirps := []chirp{}
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, databaseChirpToChirp(dbChirp))
+	}
+
+	respondWithJSONArray(w, http.StatusOK, chirps)
+}
+
+func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	var req createUserRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	req.Email = normalizeEmail(req.Email)
+	req.Username = normalizeUsername(req.Username)
+	errs := validateUserRequest(req.userRequest, cfg.minPasswordLength)
+	if req.Username != "" && !isValidUsername(req.Username) {
+		errs.add("username", "invalid", "Username must be 3-30 letters, digits or underscores")
+	}
+	if !errs.ok() {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.Password, cfg.bcryptCost)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+
+	verificationToken, err := makeVerificationToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create verification token")
+		return
+	}
+
+	var dbUser database.User
+	err = database.WithTx(ctx, cfg.dbConn, func(q *database.Queries) error {
+		var err error
+		dbUser, err = q.CreateUser(ctx, database.CreateUserParams{
+			Email:          req.Email,
+			HashedPassword: hashedPassword,
+			Username:       sql.NullString{String: req.Username, Valid: req.Username != ""},
+		})
+		if err != nil {
+			return err
+		}
+		return q.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+			Token:     verificationToken,
+			UserID:    dbUser.ID,
+			ExpiresAt: time.Now().UTC().Add(emailVerificationExpiry),
+		})
+	})
+	if isUniqueViolation(err) && violatedConstraint(err) == usernameConstraint {
+		respondWithError(w, http.StatusConflict, "Username already exists")
+		return
+	}
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "Email already exists")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+
+	cfg.sendVerificationEmail(dbUser.Email, verificationToken)
+
+	w.Header().Set("Location", "/api/users/"+dbUser.ID.String())
+	respondWithJSON(w, http.StatusCreated, databaseUserToUser(dbUser))
+}
+
+// sendVerificationEmail delivers the link that verifies email. There is no
+// mail transport yet, so the link is only logged, and only on the dev
+// platform: anyone holding it can verify the account.
+func (cfg *apiConfig) sendVerificationEmail(email, token string) {
+	if cfg.platform != "dev" {
+		slog.Info("verification email", "email", email)
+		return
+	}
+	slog.Info("verification email", "email", email, "link", "/api/verify?token="+token)
+}
+
+func (cfg *apiConfig) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondWithError(w, http.StatusBadRequest, "Verification token is required")
+		return
+	}
+
+	dbToken, err := cfg.db.GetEmailVerificationToken(ctx, token)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusBadRequest, "Invalid verification token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve verification token")
+		return
+	}
+
+	if time.Now().UTC().After(dbToken.ExpiresAt) {
+		respondWithError(w, http.StatusBadRequest, "Verification token expired")
+		return
+	}
+
+	err = database.WithTx(ctx, cfg.dbConn, func(q *database.Queries) error {
+		if err := q.MarkUserEmailVerified(ctx, dbToken.UserID); err != nil {
+			return err
+		}
+		return q.DeleteEmailVerificationToken(ctx, token)
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+
+	dbUser, err := cfg.db.GetUserByID(ctx, dbToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseUserToUser(dbUser))
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// usernameConstraint is the unique index on LOWER(username), see
+// sql/schema/014_mentions.sql.
+const usernameConstraint = "users_username_idx"
+
+// violatedConstraint returns the name of the constraint a Postgres error
+// reports, or "" if err is not one.
+func violatedConstraint(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Constraint
+	}
+	return ""
+}
+
+func databaseUserToUser(u database.User) user {
+	return user{
+		ID:            u.ID,
+		Email:         u.Email,
+		Username:      u.Username.String,
+		CreatedAt:     u.CreatedAt.UTC(),
+		UpdatedAt:     u.UpdatedAt.UTC(),
+		IsChirpyRed:   u.IsChirpyRed,
+		EmailVerified: u.EmailVerified,
+	}
+}
+
+// clientIPHash returns the salted hash of the request's client IP, or a
+// null value when IP storage is disabled.
+func (cfg *apiConfig) clientIPHash(r *http.Request) sql.NullString {
+	if !cfg.storeClientIP {
+		return sql.NullString{}
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.clientIPSalt))
+	mac.Write([]byte(clientIP(r, cfg.trustedProxies)))
+	return sql.NullString{String: hex.EncodeToString(mac.Sum(nil)), Valid: true}
+}
+
+// errEmailNotVerified is returned by chirpLimits when posting requires a
+// verified email and the user hasn't verified theirs yet.
+var errEmailNotVerified = errors.New("email not verified")
+
+// chirpLimits returns the maximum chirp length and the chirp quota for the
+// given user, both of which depend on whether they have Chirpy Red.
+func (cfg *apiConfig) chirpLimits(ctx context.Context, userID uuid.UUID) (maxLength, quota int, err error) {
+	dbUser, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if cfg.requireVerifiedEmail && !dbUser.EmailVerified {
+		return 0, 0, errEmailNotVerified
+	}
+	if dbUser.IsChirpyRed {
+		return cfg.maxChirpLengthRed, cfg.chirpQuotaRed, nil
+	}
+	return cfg.maxChirpLength, cfg.chirpQuota, nil
+}
+
+// checkChirpQuota reports whether userID may create n more chirps without
+// exceeding quota within the quota window. Soft-deleted chirps still count,
+// so deleting and reposting doesn't reset the allowance.
+func (cfg *apiConfig) checkChirpQuota(ctx context.Context, userID uuid.UUID, quota, n int) (bool, error) {
+	count, err := cfg.db.CountChirpsByUserSince(ctx, database.CountChirpsByUserSinceParams{
+		UserID: userID,
+		Since:  time.Now().UTC().Add(-cfg.chirpQuotaWindow),
+	})
+	if err != nil {
+		return false, err
+	}
+	return count+int64(n) <= int64(quota), nil
+}
+
+func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req chirpRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// A retried request replays the chirp the key first created, as long as
+	// the key hasn't expired. Keys are scoped to the user.
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" && cfg.replayIdempotentChirp(ctx, w, userID, idempotencyKey) {
+		return
+	}
+
+	limit, quota, err := cfg.chirpLimits(ctx, userID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if errors.Is(err, errEmailNotVerified) {
+		respondWithError(w, http.StatusForbidden, "Email not verified")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	allowed, err := cfg.checkChirpQuota(ctx, userID, quota, 1)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check chirp quota")
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusTooManyRequests, "Chirp quota exceeded, try again later")
+		return
+	}
+
+	if errs := validateChirpRequest(req, limit, cfg.rejectedWords); !errs.ok() {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	var parentID uuid.NullUUID
+	if req.ParentID != nil {
+		if _, err := cfg.db.GetChirpByID(ctx, *req.ParentID); err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, "Parent chirp not found")
+			return
+		} else if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve parent chirp")
+			return
+		}
+		parentID = uuid.NullUUID{UUID: *req.ParentID, Valid: true}
+	}
+
+	clientIPHash := cfg.clientIPHash(r)
+	var dbChirp database.Chirp
+	var mentions []uuid.UUID
+	err = database.WithTx(ctx, cfg.dbConn, func(q *database.Queries) error {
+		var err error
+		dbChirp, err = q.CreateChirp(ctx, database.CreateChirpParams{
+			Body:         censorText(normalizeChirpBody(req.Body), cfg.forbiddenWords, cfg.censorReplacement),
+			UserID:       userID,
+			ParentID:     parentID,
+			ClientIpHash: clientIPHash,
+		})
+		if err != nil {
+			return err
+		}
+		mentions, err = saveMentions(ctx, q, dbChirp.ID, dbChirp.Body)
+		if err != nil || idempotencyKey == "" {
+			return err
+		}
+
+		// The key is claimed in the same transaction as the insert. A
+		// concurrent retry blocks on the key's row until this commits, then
+		// finds it taken and rolls its own chirp back. Only an expired key
+		// is taken over.
+		claimed, err := q.ClaimIdempotencyKey(ctx, database.ClaimIdempotencyKeyParams{
+			Key:           idempotencyKey,
+			UserID:        userID,
+			ChirpID:       dbChirp.ID,
+			ExpiredBefore: time.Now().UTC().Add(-idempotencyKeyTTL),
+		})
+		if err != nil {
+			return err
+		}
+		if claimed == 0 {
+			return errIdempotencyKeyTaken
+		}
+		return nil
+	})
+	if errors.Is(err, errIdempotencyKeyTaken) {
+		if !cfg.replayIdempotentChirp(ctx, w, userID, idempotencyKey) {
+			respondWithError(w, http.StatusConflict, "Idempotency key is already in use")
+		}
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create chirp")
+		return
+	}
+
+	c := databaseChirpToChirp(dbChirp)
+	c.Mentions = mentions
+	cfg.chirpStream.publish(c)
+	w.Header().Set("Location", "/api/chirps/"+dbChirp.ID.String())
+	respondWithJSON(w, http.StatusCreated, c)
+}
+
+// replayIdempotentChirp responds with the chirp that an unexpired
+// Idempotency-Key already created. It returns false without writing
+// anything when there is no such chirp.
+func (cfg *apiConfig) replayIdempotentChirp(ctx context.Context, w http.ResponseWriter, userID uuid.UUID, key string) bool {
+	dbChirp, err := cfg.db.GetIdempotentChirp(ctx, database.GetIdempotentChirpParams{
+		UserID: userID,
+		Key:    key,
+		Since:  time.Now().UTC().Add(-idempotencyKeyTTL),
+	})
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check idempotency key")
+		return true
+	}
+
+	c := databaseChirpToChirp(dbChirp)
+	c.Mentions, err = cfg.chirpMentions(ctx, dbChirp.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mentions")
+		return true
+	}
+	w.Header().Set("Location", "/api/chirps/"+dbChirp.ID.String())
+	respondWithJSON(w, http.StatusOK, c)
+	return true
+}
+
+// bulkCreateChirpsHandler inserts a batch of chirps in one transaction, so
+// either every chirp is created or none are.
+func (cfg *apiConfig) bulkCreateChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var reqs []chirpRequest
+	if !decodeJSON(w, r, &reqs) {
+		return
+	}
+
+	if len(reqs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one chirp is required")
+		return
+	}
+	if len(reqs) > maxBulkChirps {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Too many chirps (max %d per request)", maxBulkChirps))
+		return
+	}
+
+	limit, quota, err := cfg.chirpLimits(ctx, userID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if errors.Is(err, errEmailNotVerified) {
+		respondWithError(w, http.StatusForbidden, "Email not verified")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	allowed, err := cfg.checkChirpQuota(ctx, userID, quota, len(reqs))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check chirp quota")
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusTooManyRequests, "Chirp quota exceeded, try again later")
+		return
+	}
+
+	parentIDs := make([]uuid.NullUUID, len(reqs))
+	for i, req := range reqs {
+		if errs := validateChirpRequest(req, limit, cfg.rejectedWords); !errs.ok() {
+			respondWithValidationErrors(w, errs.atIndex(i))
+			return
+		}
+
+		if req.ParentID == nil {
+			continue
+		}
+		_, err := cfg.db.GetChirpByID(ctx, *req.ParentID)
+		if err == sql.ErrNoRows {
+			errs := &validationErrors{}
+			errs.add("parent_id", "not_found", "Parent chirp not found")
+			respondWithValidationErrors(w, errs.atIndex(i))
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve parent chirp")
+			return
+		}
+		parentIDs[i] = uuid.NullUUID{UUID: *req.ParentID, Valid: true}
+	}
+
+	clientIPHash := cfg.clientIPHash(r)
+	chirps := make([]chirp, 0, len(reqs))
+	err = database.WithTx(ctx, cfg.dbConn, func(q *database.Queries) error {
+		for i, req := range reqs {
+			dbChirp, err := q.CreateChirp(ctx, database.CreateChirpParams{
+				Body:         censorText(normalizeChirpBody(req.Body), cfg.forbiddenWords, cfg.censorReplacement),
+				UserID:       userID,
+				ParentID:     parentIDs[i],
+				ClientIpHash: clientIPHash,
+			})
+			if err != nil {
+				return err
+			}
+			c := databaseChirpToChirp(dbChirp)
+			c.Mentions, err = saveMentions(ctx, q, dbChirp.ID, dbChirp.Body)
+			if err != nil {
+				return err
+			}
+			chirps = append(chirps, c)
+		}
+		return nil
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create chirps")
+		return
+	}
+
+	for _, c := range chirps {
+		cfg.chirpStream.publish(c)
+	}
+
+	respondWithJSON(w, http.StatusCreated, chirps)
+}
+
+func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	var params database.GetChirpsParams
+
+	if authorIDParam := r.URL.Query().Get("author_id"); authorIDParam != "" {
+		authorID, err := uuid.Parse(authorIDParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+
+	// Timestamps are stored in UTC without a zone, so bounds are converted
+	// to UTC before comparing.
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		since, err := time.Parse(time.RFC3339, sinceParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid since timestamp")
+			return
+		}
+		params.Since = sql.NullTime{Time: since.UTC(), Valid: true}
+	}
+
+	if beforeParam := r.URL.Query().Get("before"); beforeParam != "" {
+		before, err := time.Parse(time.RFC3339, beforeParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid before timestamp")
+			return
+		}
+		params.Before = sql.NullTime{Time: before.UTC(), Valid: true}
+	}
+
+	var ok bool
+	if params.IncludeDeleted, ok = cfg.includeDeleted(w, r); !ok {
+		return
+	}
+
+	// A chirp counts as censored-only when nothing but replacement tokens,
+	// punctuation and spaces is left of it.
+	if r.URL.Query().Get("hide_censored") == "true" {
+		params.HideCensored = true
+		params.CensorReplacement = cfg.censorReplacement
+	}
+
+	// Anything other than an explicit "desc" falls back to ascending order.
+	params.SortDesc = r.URL.Query().Get("sort") == "desc"
+
+	params.Limit, params.Offset = cfg.parsePagination(r)
+	w.Header().Set("X-Limit", strconv.Itoa(int(params.Limit)))
+	w.Header().Set("X-Offset", strconv.Itoa(int(params.Offset)))
+
+	// The total only matters to clients that page, so the extra COUNT is
+	// skipped for a plain listing. It applies the same filters as the
+	// listing so that it matches the rows being paged through.
+	if r.URL.Query().Has("limit") || r.URL.Query().Has("offset") {
+		total, err := cfg.db.CountChirps(ctx, database.CountChirpsParams{
+			AuthorID:          params.AuthorID,
+			Since:             params.Since,
+			Before:            params.Before,
+			IncludeDeleted:    params.IncludeDeleted,
+			HideCensored:      params.HideCensored,
+			CensorReplacement: params.CensorReplacement,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to count chirps")
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	includeStats := r.URL.Query().Get("stats") == "true"
+
+	chirps := []chirp{}
+	if r.URL.Query().Get("include") == "author" {
+		rows, err := cfg.db.GetChirpsWithAuthor(ctx, database.GetChirpsWithAuthorParams(params))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+		for _, row := range rows {
+			c := databaseChirpToChirp(database.Chirp{
+				ID:        row.ID,
+				CreatedAt: row.CreatedAt,
+				UpdatedAt: row.UpdatedAt,
+				Body:      row.Body,
+				UserID:    row.UserID,
+				DeletedAt: row.DeletedAt,
+				ParentID:  row.ParentID,
+			})
+			// The join is a LEFT JOIN, so a missing author shows up as
+			// a placeholder rather than dropping the chirp.
+			authorEmail := deletedAuthorPlaceholder
+			if row.AuthorEmail.Valid {
+				authorEmail = row.AuthorEmail.String
+			}
+			c.AuthorEmail = &authorEmail
+			if includeStats {
+				c = c.withStats()
+			}
+			chirps = append(chirps, c)
+		}
+	} else {
+		dbChirps, err := cfg.db.GetChirps(ctx, params)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+		for _, dbChirp := range dbChirps {
+			c := databaseChirpToChirp(dbChirp)
+			if includeStats {
+				c = c.withStats()
+			}
+			chirps = append(chirps, c)
+		}
+	}
+
+	if err := cfg.attachLikeCounts(ctx, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve like counts")
+		return
+	}
+	if err := cfg.attachMentions(ctx, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mentions")
+		return
+	}
+
+	respondWithJSONArray(w, http.StatusOK, chirps)
+}
+
+func (cfg *apiConfig) countChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	var authorID uuid.NullUUID
+	if authorIDParam := r.URL.Query().Get("author_id"); authorIDParam != "" {
+		id, err := uuid.Parse(authorIDParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	count, err := cfg.db.CountChirps(ctx, database.CountChirpsParams{AuthorID: authorID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count chirps")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, countResponse{Count: count})
+}
+
+// exportChirpsHandler streams all of the caller's chirps as NDJSON, one
+// chirp per line, for download. It pages through them by (created_at, id)
+// rather than loading the whole account at once. Once the first page has
+// been sent the status is committed, so a later failure can only truncate
+// the file; it is logged.
+func (cfg *apiConfig) exportChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	var afterCreatedAt time.Time
+	afterID := uuid.Nil
+	for page := 0; ; page++ {
+		ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+		dbChirps, err := cfg.db.GetChirpsByAuthorAfter(ctx, database.GetChirpsByAuthorAfterParams{
+			UserID:         userID,
+			AfterCreatedAt: afterCreatedAt,
+			AfterID:        afterID,
+			Limit:          exportPageSize,
+		})
+		chirps := make([]chirp, 0, len(dbChirps))
+		for _, dbChirp := range dbChirps {
+			chirps = append(chirps, databaseChirpToChirp(dbChirp))
+		}
+		if err == nil {
+			err = cfg.attachLikeCounts(ctx, chirps)
+		}
+		if err == nil {
+			err = cfg.attachMentions(ctx, chirps)
+		}
+		cancel()
+
+		if err != nil && page == 0 {
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+		if err != nil {
+			slog.Error("chirp export aborted", "user_id", userID, "error", err)
+			return
+		}
+
+		if page == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", `attachment; filename="chirps.ndjson"`)
+			w.WriteHeader(http.StatusOK)
+		}
+		rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		for _, c := range chirps {
+			if err := enc.Encode(c); err != nil {
+				slog.Error("chirp export aborted", "user_id", userID, "error", err)
+				return
+			}
+		}
+		if len(dbChirps) < exportPageSize {
+			return
+		}
+		rc.Flush()
+
+		last := dbChirps[len(dbChirps)-1]
+		afterCreatedAt, afterID = last.CreatedAt, last.ID
+	}
+}
+
+func (cfg *apiConfig) randomChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	dbChirp, err := cfg.db.GetRandomChirp(ctx)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "No chirps found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+		return
+	}
+
+	c := databaseChirpToChirp(dbChirp)
+	c.LikeCount, err = cfg.db.CountChirpLikes(ctx, dbChirp.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve like count")
+		return
+	}
+	c.Mentions, err = cfg.chirpMentions(ctx, dbChirp.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mentions")
+		return
+	}
+	if r.URL.Query().Get("stats") == "true" {
+		c = c.withStats()
+	}
+
+	respondWithJSON(w, http.StatusOK, c)
+}
+
+// parsePagination reads limit and offset from the query string. Values that
+// are missing or malformed fall back to the defaults, and out-of-range
+// values are clamped rather than rejected. The limit never exceeds
+// cfg.maxRowsPerRequest.
+func (cfg *apiConfig) parsePagination(r *http.Request) (limit, offset int32) {
+	limit = int32(min(defaultChirpsLimit, cfg.maxRowsPerRequest))
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		limit = int32(min(max(v, 1), cfg.maxRowsPerRequest))
+	}
+
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil {
+		offset = int32(min(max(v, 0), math.MaxInt32))
+	}
+
+	return limit, offset
+}
+
+// chirpETag derives a weak validator from the chirp's last update time and
+// like count, since liking a chirp doesn't touch updated_at.
+func chirpETag(c database.Chirp, likeCount int64) string {
+	return fmt.Sprintf(`W/"%x-%x"`, c.UpdatedAt.UnixNano(), likeCount)
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison that RFC 9110 prescribes for GET.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *apiConfig) getChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	includeDeleted, ok := cfg.includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	var dbChirp database.Chirp
+	if includeDeleted {
+		dbChirp, err = cfg.db.GetChirpByIDIncludingDeleted(ctx, chirpID)
+	} else {
+		dbChirp, err = cfg.db.GetChirpByID(ctx, chirpID)
+	}
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+		return
+	}
+
+	likeCount, err := cfg.db.CountChirpLikes(ctx, dbChirp.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve like count")
+		return
+	}
+
+	etag := chirpETag(dbChirp, likeCount)
+	w.Header().Set("ETag", etag)
+	// Last-Modified is what clients send back in If-Unmodified-Since when
+	// editing.
+	w.Header().Set("Last-Modified", dbChirp.UpdatedAt.UTC().Format(http.TimeFormat))
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	c := databaseChirpToChirp(dbChirp)
+	c.LikeCount = likeCount
+	c.Mentions, err = cfg.chirpMentions(ctx, dbChirp.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mentions")
+		return
+	}
+	if r.URL.Query().Get("stats") == "true" {
+		c = c.withStats()
+	}
+
+	respondWithJSON(w, http.StatusOK, c)
+}
+
+// Timestamps are normalized to UTC so that they always encode as RFC3339
+// with a "Z" suffix, regardless of how the driver scanned them.
+func databaseChirpToChirp(c database.Chirp) chirp {
+	out := chirp{
+		ID:        c.ID,
+		Body:      c.Body,
+		UserID:    c.UserID,
+		CreatedAt: c.CreatedAt.UTC(),
+		UpdatedAt: c.UpdatedAt.UTC(),
+		Mentions:  []uuid.UUID{},
+	}
+	if c.ParentID.Valid {
+		parentID := c.ParentID.UUID
+		out.ParentID = &parentID
+	}
+	if c.DeletedAt.Valid {
+		deletedAt := c.DeletedAt.Time.UTC()
+		out.DeletedAt = &deletedAt
+	}
+	return out
+}
+
+// attachLikeCounts fills in LikeCount for each chirp using one aggregate
+// query rather than a COUNT per chirp.
+func (cfg *apiConfig) attachLikeCounts(ctx context.Context, chirps []chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.ID
+	}
+
+	rows, err := cfg.db.GetLikeCounts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ChirpID] = row.LikeCount
+	}
+	for i := range chirps {
+		chirps[i].LikeCount = counts[chirps[i].ID]
+	}
+	return nil
+}
+
+// chirpMentions returns the IDs of the users mentioned in one chirp.
+func (cfg *apiConfig) chirpMentions(ctx context.Context, chirpID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := cfg.db.GetMentionsForChirps(ctx, []uuid.UUID{chirpID})
+	if err != nil {
+		return nil, err
+	}
+
+	mentions := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		mentions = append(mentions, row.UserID)
+	}
+	return mentions, nil
+}
+
+// attachMentions fills in Mentions for each chirp with a single query, in
+// the same way as attachLikeCounts.
+func (cfg *apiConfig) attachMentions(ctx context.Context, chirps []chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.ID
+	}
+
+	rows, err := cfg.db.GetMentionsForChirps(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	mentions := make(map[uuid.UUID][]uuid.UUID)
+	for _, row := range rows {
+		mentions[row.ChirpID] = append(mentions[row.ChirpID], row.UserID)
+	}
+	for i := range chirps {
+		if userIDs, ok := mentions[chirps[i].ID]; ok {
+			chirps[i].Mentions = userIDs
+		}
+	}
+	return nil
+}
+
+// includeDeleted reports whether the request asked to see soft-deleted
+// chirps. That is only allowed on the dev platform; elsewhere it writes a
+// 403 and returns ok=false.
+func (cfg *apiConfig) includeDeleted(w http.ResponseWriter, r *http.Request) (include, ok bool) {
+	if r.URL.Query().Get("include_deleted") != "true" {
+		return false, true
+	}
+	if cfg.platform != "dev" {
+		respondWithError(w, http.StatusForbidden, "include_deleted is only available on the dev platform")
+		return false, false
+	}
+	return true, true
+}
+
+func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	var req struct {
+		Email            string `json:"email"`
+		Password         string `json:"password"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	email := normalizeEmail(req.Email)
+	if locked, remaining := cfg.loginThrottle.locked(email); locked {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts")
+		return
+	}
+
+	dbUser, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	// Unknown emails and wrong passwords share the same response so that
+	// callers can't probe which accounts exist.
+	if err == sql.ErrNoRows || checkPasswordHash(req.Password, dbUser.HashedPassword) != nil {
+		cfg.loginThrottle.recordFailure(email)
+		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+		return
+	}
+	cfg.loginThrottle.reset(email)
+
+	// Clients may ask for a shorter-lived token, but never a longer one.
+	expiresIn := defaultJWTExpiry
+	if req.ExpiresInSeconds > 0 && req.ExpiresInSeconds < int(defaultJWTExpiry/time.Second) {
+		expiresIn = time.Duration(req.ExpiresInSeconds) * time.Second
+	}
+
+	token, err := makeJWT(dbUser.ID, cfg.jwtKeys, cfg.jwtAudience, expiresIn)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+
+	refreshToken, err := makeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create refresh token")
+		return
+	}
+
+	_, err = cfg.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().UTC().Add(refreshTokenExpiry),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create refresh token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, loginResponse{user: databaseUserToUser(dbUser), Token: token, RefreshToken: refreshToken})
+}
+
+func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	refreshToken, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := cfg.db.GetUserIDFromRefreshToken(ctx, refreshToken)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve refresh token")
+		return
+	}
+
+	token, err := makeJWT(userID, cfg.jwtKeys, cfg.jwtAudience, defaultJWTExpiry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		Token string `json:"token"`
+	}{Token: token})
+}
+
+func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	refreshToken, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	n, err := cfg.db.RevokeRefreshToken(ctx, refreshToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke refresh token")
+		return
+	}
+
+	if n == 0 {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req userRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	req.Email = normalizeEmail(req.Email)
+	if errs := validateUserRequest(req, cfg.minPasswordLength); !errs.ok() {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.Password, cfg.bcryptCost)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+
+	// UpdateUser clears email_verified when the address changes. The new
+	// address gets a fresh link, and links sent to the old one stop working.
+	var dbUser database.User
+	var verificationToken string
+	err = database.WithTx(ctx, cfg.dbConn, func(q *database.Queries) error {
+		current, err := q.GetUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		dbUser, err = q.UpdateUser(ctx, database.UpdateUserParams{
+			ID:             userID,
+			Email:          req.Email,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil || dbUser.Email == current.Email {
+			return err
+		}
+
+		if err := q.DeleteEmailVerificationTokensByUser(ctx, userID); err != nil {
+			return err
+		}
+		verificationToken, err = makeVerificationToken()
+		if err != nil {
+			return err
+		}
+		return q.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+			Token:     verificationToken,
+			UserID:    userID,
+			ExpiresAt: time.Now().UTC().Add(emailVerificationExpiry),
+		})
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "Email already exists")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update user")
+		return
+	}
+
+	if verificationToken != "" {
+		cfg.sendVerificationEmail(dbUser.Email, verificationToken)
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseUserToUser(dbUser))
+}
+
+func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirpByID(ctx, chirpID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+		return
+	}
+
+	if dbChirp.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	err = cfg.db.SoftDeleteChirp(ctx, chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) likeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpLiked(w, r, true)
+}
+
+func (cfg *apiConfig) unlikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpLiked(w, r, false)
+}
+
+// setChirpLiked adds or removes the caller's like on a chirp. Both directions
+// are idempotent and respond with the chirp's current like count.
+func (cfg *apiConfig) setChirpLiked(w http.ResponseWriter, r *http.Request, liked bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirpByID(ctx, chirpID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+		return
+	}
+
+	if liked {
+		err = cfg.db.LikeChirp(ctx, database.LikeChirpParams{UserID: userID, ChirpID: chirpID})
+	} else {
+		err = cfg.db.UnlikeChirp(ctx, database.UnlikeChirpParams{UserID: userID, ChirpID: chirpID})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update like")
+		return
+	}
+
+	c := databaseChirpToChirp(dbChirp)
+	c.LikeCount, err = cfg.db.CountChirpLikes(ctx, chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve like count")
+		return
+	}
+	c.Mentions, err = cfg.chirpMentions(ctx, chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mentions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, c)
+}
+
+// reportChirpHandler flags a chirp for moderation. Reporting the same chirp
+// again is a no-op, so the first reason given is the one kept.
+func (cfg *apiConfig) reportChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	var req reportRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		respondWithError(w, http.StatusBadRequest, "Report reason is required")
+		return
+	}
+
+	_, err = cfg.db.GetChirpByID(ctx, chirpID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+		return
+	}
+
+	err = cfg.db.ReportChirp(ctx, database.ReportChirpParams{
+		ReporterID: userID,
+		ChirpID:    chirpID,
+		Reason:     req.Reason,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to report chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) polkaWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	apiKey, err := getAPIKey(r.Header)
+	if err != nil || subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) != 1 {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Event string `json:"event"`
+		Data  struct {
+			UserID string `json:"user_id"`
+		} `json:"data"`
+	}
+	if !decodeJSONAllowUnknown(w, r, &req) {
+		return
+	}
+
+	if req.Event != "user.upgraded" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	userID, err := uuid.Parse(req.Data.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	n, err := cfg.db.UpgradeUserToChirpyRed(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to upgrade user")
+		return
+	}
+
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) getCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	dbUser, err := cfg.db.GetUserByID(ctx, userID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseUserToUser(dbUser))
+}
+
+func (cfg *apiConfig) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	dbUser, err := cfg.db.GetUserByID(ctx, userID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, publicUser{
+		ID:          dbUser.ID,
+		Email:       dbUser.Email,
+		Username:    dbUser.Username.String,
+		CreatedAt:   dbUser.CreatedAt.UTC(),
+		IsChirpyRed: dbUser.IsChirpyRed,
+	})
+}
+
+// getUserByUsernameHandler looks a user up by username, ignoring case since
+// usernames are stored lowercased.
+func (cfg *apiConfig) getUserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	dbUser, err := cfg.db.GetUserByUsername(ctx, r.PathValue("username"))
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, userProfile{
+		ID:          dbUser.ID,
+		Username:    dbUser.Username.String,
+		CreatedAt:   dbUser.CreatedAt.UTC(),
+		IsChirpyRed: dbUser.IsChirpyRed,
+	})
+}
+
+// batchGetUsersHandler returns the public profiles for up to
+// maxBatchUserIDs users in one query. IDs with no user are left out of the
+// result rather than reported.
+func (cfg *apiConfig) batchGetUsersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	var req batchUsersRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.IDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+	if len(req.IDs) > maxBatchUserIDs {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Too many ids (max %d per request)", maxBatchUserIDs))
+		return
+	}
+
+	dbUsers, err := cfg.db.GetUsersByIDs(ctx, req.IDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve users")
+		return
+	}
+
+	users := make([]publicUser, 0, len(dbUsers))
+	for _, dbUser := range dbUsers {
+		users = append(users, publicUser{
+			ID:          dbUser.ID,
+			Email:       dbUser.Email,
+			Username:    dbUser.Username.String,
+			CreatedAt:   dbUser.CreatedAt.UTC(),
+			IsChirpyRed: dbUser.IsChirpyRed,
+		})
+	}
+
+	respondWithJSONArray(w, http.StatusOK, users)
+}
+
+func (cfg *apiConfig) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setFollowing(w, r, true)
+}
+
+func (cfg *apiConfig) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setFollowing(w, r, false)
+}
+
+// setFollowing adds or removes a follow from the caller to the user in the
+// path. Both directions are idempotent.
+func (cfg *apiConfig) setFollowing(w http.ResponseWriter, r *http.Request, following bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	followerID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if followeeID == followerID {
+		respondWithError(w, http.StatusBadRequest, "You cannot follow yourself")
+		return
+	}
+
+	_, err = cfg.db.GetUserByID(ctx, followeeID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	if following {
+		err = cfg.db.FollowUser(ctx, database.FollowUserParams{FollowerID: followerID, FolloweeID: followeeID})
+	} else {
+		err = cfg.db.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: followerID, FolloweeID: followeeID})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update follow")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) feedHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	limit, offset := cfg.parsePagination(r)
+	w.Header().Set("X-Limit", strconv.Itoa(int(limit)))
+	w.Header().Set("X-Offset", strconv.Itoa(int(offset)))
+
+	dbChirps, err := cfg.db.GetFeed(ctx, database.GetFeedParams{
+		FollowerID: userID,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve feed")
+		return
+	}
+
+	chirps := []chirp{}
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, databaseChirpToChirp(dbChirp))
+	}
+
+	if err := cfg.attachLikeCounts(ctx, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve like counts")
+		return
+	}
+	if err := cfg.attachMentions(ctx, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mentions")
+		return
+	}
+
+	respondWithJSONArray(w, http.StatusOK, chirps)
+}
+
+func (cfg *apiConfig) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// The foreign keys would cascade on their own, but deleting each table
+	// explicitly inside one transaction keeps the steps visible and
+	// guarantees a failure leaves the account intact.
+	var n int64
+	err = database.WithTx(ctx, cfg.dbConn, func(q *database.Queries) error {
+		if _, err := q.DeleteChirpsByUser(ctx, userID); err != nil {
+			return err
+		}
+		if _, err := q.DeleteRefreshTokensByUser(ctx, userID); err != nil {
+			return err
+		}
+		var err error
+		n, err = q.DeleteUser(ctx, userID)
+		return err
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete user")
+		return
+	}
+
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// likeEscaper escapes the LIKE wildcards so that search terms match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (cfg *apiConfig) searchChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		respondWithError(w, http.StatusBadRequest, "Search term is required")
+		return
+	}
+
+	dbChirps, err := cfg.db.SearchChirps(ctx, database.SearchChirpsParams{
+		Term:  likeEscaper.Replace(q),
+		Limit: int32(cfg.maxRowsPerRequest),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to search chirps")
+		return
+	}
+
+	chirps := []chirp{}
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, databaseChirpToChirp(dbChirp))
+	}
+
+	if err := cfg.attachLikeCounts(ctx, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve like counts")
+		return
+	}
+	if err := cfg.attachMentions(ctx, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mentions")
+		return
+	}
+
+	respondWithJSONArray(w, http.StatusOK, chirps)
+}
+
+func (cfg *apiConfig) getChirpRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	if _, err := cfg.db.GetChirpByID(ctx, chirpID); err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+		return
+	}
+
+	dbChirps, err := cfg.db.GetChirpReplies(ctx, database.GetChirpRepliesParams{
+		ParentID: uuid.NullUUID{UUID: chirpID, Valid: true},
+		Limit:    int32(cfg.maxRowsPerRequest),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve replies")
+		return
+	}
+
+	chirps := []chirp{}
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, databaseChirpToChirp(dbChirp))
+	}
+
+	if err := cfg.attachLikeCounts(ctx, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve like counts")
+		return
+	}
+	if err := cfg.attachMentions(ctx, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mentions")
+		return
+	}
+
+	respondWithJSONArray(w, http.StatusOK, chirps)
+}
+
+func (cfg *apiConfig) updateChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbQueryTimeout)
+	defer cancel()
+
+	token, err := getBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := validateJWT(token, cfg.jwtKeys, cfg.jwtAudience)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirpByID(ctx, chirpID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+		return
+	}
+
+	if dbChirp.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var req chirpRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	limit, _, err := cfg.chirpLimits(ctx, userID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if errors.Is(err, errEmailNotVerified) {
+		respondWithError(w, http.StatusForbidden, "Email not verified")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	if errs := validateChirpRequest(req, limit, cfg.rejectedWords); !errs.ok() {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	// If-Unmodified-Since makes the edit conditional. The check happens in
+	// the UPDATE itself so that two racing edits can't both pass it. HTTP
+	// dates only have second precision, and per RFC 9110 an unparseable
+	// date is ignored.
+	var unmodifiedSince sql.NullTime
+	if t, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil {
+		unmodifiedSince = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+
+	// Mentions follow the body, so they are rebuilt from scratch.
+	var mentions []uuid.UUID
+	err = database.WithTx(ctx, cfg.dbConn, func(q *database.Queries) error {
+		var err error
+		dbChirp, err = q.UpdateChirp(ctx, database.UpdateChirpParams{
+			ID:              chirpID,
+			Body:            censorText(normalizeChirpBody(req.Body), cfg.forbiddenWords, cfg.censorReplacement),
+			UnmodifiedSince: unmodifiedSince,
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.DeleteChirpMentions(ctx, chirpID); err != nil {
+			return err
+		}
+		mentions, err = saveMentions(ctx, q, chirpID, dbChirp.Body)
+		return err
+	})
+	// The chirp was found above, so no row here means the precondition
+	// failed.
+	if err == sql.ErrNoRows && unmodifiedSince.Valid {
+		respondWithError(w, http.StatusPreconditionFailed, "Chirp has been modified since If-Unmodified-Since")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update chirp")
+		return
 	}
 
-	_, err := cfg.db.Exec("INSERT INTO users (id, email, created_at, updated_at) VALUES ($1, $2, $3, $4)",
-		newUser.ID, newUser.Email, newUser.CreatedAt, newUser.UpdatedAt)
+	w.Header().Set("Last-Modified", dbChirp.UpdatedAt.UTC().Format(http.TimeFormat))
+	c := databaseChirpToChirp(dbChirp)
+	c.Mentions = mentions
+	c.LikeCount, err = cfg.db.CountChirpLikes(ctx, chirpID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(errorResponse{Error: "Failed to create user"})
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve like count")
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(newUser)
+	respondWithJSON(w, http.StatusOK, c)
 }
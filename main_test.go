@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mirenk0/chirpy/internal/database"
+)
+
+func TestCensorText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain word", "I had a kerfuffle", "I had a ****"},
+		{"mixed case", "Sharbert is here", "**** is here"},
+		{"trailing comma", "kerfuffle, again", "****, again"},
+		{"trailing period", "That was a fornax.", "That was a ****."},
+		{"trailing exclamation", "Sharbert!", "****!"},
+		{"surrounding punctuation", `"fornax"?`, `"****"?`},
+		{"substring is kept", "kerfuffles happen", "kerfuffles happen"},
+		{"punctuation only", "!!! ...", "!!! ..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := censorText(tt.text, defaultForbiddenWords, defaultCensorReplacement)
+			if got != tt.want {
+				t.Errorf("censorText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseForbiddenWords(t *testing.T) {
+	words := parseForbiddenWords(" Darn, ,HECK ,gosh")
+	want := []string{"darn", "heck", "gosh"}
+	if len(words) != len(want) {
+		t.Fatalf("parseForbiddenWords = %q, want %q", words, want)
+	}
+	for i := range want {
+		if words[i] != want[i] {
+			t.Fatalf("parseForbiddenWords = %q, want %q", words, want)
+		}
+	}
+}
+
+func TestCustomForbiddenWordsOverrideDefaults(t *testing.T) {
+	words := parseForbiddenWords("darn")
+	got := censorText("darn that kerfuffle", words, defaultCensorReplacement)
+	if want := "**** that kerfuffle"; got != want {
+		t.Errorf("censorText = %q, want %q", got, want)
+	}
+}
+
+func TestParseModerationRules(t *testing.T) {
+	replace, reject, err := parseModerationRules(`{" Darn ": "replace", "heck": "replace", "SPAM": "reject"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(replace)
+	if want := []string{"darn", "heck"}; !slices.Equal(replace, want) {
+		t.Errorf("replace = %q, want %q", replace, want)
+	}
+	if want := []string{"spam"}; !slices.Equal(reject, want) {
+		t.Errorf("reject = %q, want %q", reject, want)
+	}
+}
+
+func TestParseModerationRulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{"invalid JSON", `{"darn": "replace"`},
+		{"not an object", `["darn"]`},
+		{"unknown action", `{"darn": "mute"}`},
+		{"empty word", `{" ": "reject"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parseModerationRules(tt.rules); err == nil {
+				t.Errorf("parseModerationRules(%s) succeeded, want an error", tt.rules)
+			}
+		})
+	}
+}
+
+func TestModerationReplaceWordsAreCensored(t *testing.T) {
+	replace, _, err := parseModerationRules(`{"darn": "replace", "spam": "reject"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := censorText("Darn, no spam here", replace, defaultCensorReplacement)
+	if want := "****, no spam here"; got != want {
+		t.Errorf("censorText = %q, want %q", got, want)
+	}
+}
+
+func TestDBReadinessBeforeStartup(t *testing.T) {
+	cfg := &apiConfig{}
+	rec := httptest.NewRecorder()
+	cfg.dbReadinessHandler(rec, httptest.NewRequest(http.MethodGet, "/api/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := rec.Body.String(); got != "Starting\n" {
+		t.Errorf("body = %q, want %q", got, "Starting\n")
+	}
+}
+
+func TestUsernameOnlyAcceptedOnSignUp(t *testing.T) {
+	body := `{"email":"a@example.com","password":"hunter2hunter2","username":"walt"}`
+
+	var signUp createUserRequest
+	if _, ok := decodeTestRequest(t, "application/json", body, &signUp); !ok {
+		t.Fatal("decodeJSON rejected a username on sign-up")
+	}
+	if signUp.Username != "walt" || signUp.Email != "a@example.com" {
+		t.Errorf("decoded %+v", signUp)
+	}
+
+	var update userRequest
+	rec, ok := decodeTestRequest(t, "application/json", body, &update)
+	if ok {
+		t.Fatal("decodeJSON accepted a username on update")
+	}
+	assertErrorResponse(t, rec, http.StatusBadRequest, `Unknown field "username"`)
+}
+
+func TestChirpTimestampsAreUTC(t *testing.T) {
+	local := time.Date(2024, 3, 1, 9, 30, 0, 0, time.FixedZone("EST", -5*60*60))
+	c := databaseChirpToChirp(database.Chirp{ID: uuid.New(), CreatedAt: local, UpdatedAt: local})
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"created_at":"2024-03-01T14:30:00Z"`; !strings.Contains(string(data), want) {
+		t.Errorf("JSON %s does not contain %s", data, want)
+	}
+	if want := `"updated_at":"2024-03-01T14:30:00Z"`; !strings.Contains(string(data), want) {
+		t.Errorf("JSON %s does not contain %s", data, want)
+	}
+}
+
+func TestWithDSNParam(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"postgres://u:p@localhost:5432/chirpy?sslmode=disable", "postgres://u:p@localhost:5432/chirpy?sslmode=disable&timezone=UTC"},
+		{"postgres://localhost/chirpy?timezone=EST", "postgres://localhost/chirpy?timezone=UTC"},
+		{"host=localhost dbname=chirpy", "host=localhost dbname=chirpy timezone=UTC"},
+	}
+	for _, tt := range tests {
+		if got := withDSNParam(tt.dsn, "timezone", "UTC"); got != tt.want {
+			t.Errorf("withDSNParam(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
+
+func TestCensorTextCustomReplacement(t *testing.T) {
+	got := censorText("What a kerfuffle!", defaultForbiddenWords, "[redacted]")
+	if want := "What a [redacted]!"; got != want {
+		t.Errorf("censorText = %q, want %q", got, want)
+	}
+}
+
+func TestChirpValidateHandlerCustomReplacement(t *testing.T) {
+	cfg := &apiConfig{
+		forbiddenWords:    defaultForbiddenWords,
+		censorReplacement: "[redacted]",
+		maxChirpLength:    defaultMaxChirpLength,
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/validate_chirp", strings.NewReader(`{"body":"sharbert, please"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	cfg.chirpValidateHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp successResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[redacted], please"; resp.CleanedBody != want {
+		t.Errorf("cleaned_body = %q, want %q", resp.CleanedBody, want)
+	}
+}
+
+// newChirpTestConfig returns an apiConfig backed by a freshly migrated test
+// database, along with a user, an access token for them and one chirp.
+func newChirpTestConfig(t *testing.T) (*apiConfig, string, database.Chirp) {
+	t.Helper()
+	db := newMigratedTestDB(t)
+	cfg := &apiConfig{
+		db:                database.New(db),
+		dbConn:            db,
+		jwtKeys:           singleJWTKey("test-secret"),
+		forbiddenWords:    defaultForbiddenWords,
+		censorReplacement: defaultCensorReplacement,
+		maxChirpLength:    140,
+		maxChirpLengthRed: 140,
+	}
+
+	ctx := context.Background()
+	user, err := cfg.db.CreateUser(ctx, database.CreateUserParams{
+		Email:          "walt@example.com",
+		HashedPassword: "unused",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := makeJWT(user.ID, cfg.jwtKeys, cfg.jwtAudience, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "first draft", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, token, c
+}
+
+// putChirp sends body to updateChirpHandler. A zero unmodifiedSince sends
+// no If-Unmodified-Since header.
+func putChirp(cfg *apiConfig, token string, chirpID uuid.UUID, body string, unmodifiedSince time.Time) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/api/chirps/"+chirpID.String(), strings.NewReader(body))
+	req.SetPathValue("chirpID", chirpID.String())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if !unmodifiedSince.IsZero() {
+		req.Header.Set("If-Unmodified-Since", unmodifiedSince.UTC().Format(http.TimeFormat))
+	}
+	rec := httptest.NewRecorder()
+	cfg.updateChirpHandler(rec, req)
+	return rec
+}
+
+func TestUpdateChirpStaleIfUnmodifiedSince(t *testing.T) {
+	cfg, token, c := newChirpTestConfig(t)
+
+	rec := putChirp(cfg, token, c.ID, `{"body": "second draft"}`, c.UpdatedAt.Add(-time.Hour))
+	assertErrorResponse(t, rec, http.StatusPreconditionFailed, "Chirp has been modified since If-Unmodified-Since")
+
+	got, err := cfg.db.GetChirpByID(context.Background(), c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Body != c.Body {
+		t.Errorf("body = %q after a failed precondition, want %q", got.Body, c.Body)
+	}
+}
+
+func TestUpdateChirpCurrentIfUnmodifiedSince(t *testing.T) {
+	cfg, token, c := newChirpTestConfig(t)
+
+	rec := putChirp(cfg, token, c.ID, `{"body": "second draft"}`, c.UpdatedAt.Add(time.Second))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+
+func TestUpdateChirpChecksOwnershipBeforeBody(t *testing.T) {
+	cfg, _, c := newChirpTestConfig(t)
+
+	other, err := cfg.db.CreateUser(context.Background(), database.CreateUserParams{
+		Email:          "jesse@example.com",
+		HashedPassword: "unused",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, err := makeJWT(other.ID, cfg.jwtKeys, cfg.jwtAudience, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tooLong := `{"body": "` + strings.Repeat("a", 500) + `"}`
+	rec := putChirp(cfg, otherToken, c.ID, tooLong, time.Time{})
+	assertErrorResponse(t, rec, http.StatusForbidden, "Forbidden")
+
+	rec = putChirp(cfg, otherToken, uuid.New(), tooLong, time.Time{})
+	assertErrorResponse(t, rec, http.StatusNotFound, "Chirp not found")
+}
+
+func TestResetDeletesUsersAndChirps(t *testing.T) {
+	cfg, _, _ := newChirpTestConfig(t)
+	cfg.platform = "dev"
+
+	rec := httptest.NewRecorder()
+	cfg.resetHandler(rec, httptest.NewRequest(http.MethodPost, "/admin/reset", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp resetResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.UsersDeleted != 1 || resp.ChirpsDeleted != 1 {
+		t.Errorf("reset deleted %d users and %d chirps, want 1 and 1", resp.UsersDeleted, resp.ChirpsDeleted)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed sql/schema/*.sql
+var migrationsFS embed.FS
+
+// runMigrations applies every embedded schema file that hasn't been applied
+// yet, in filename order. Files use goose annotations; only the
+// "-- +goose Up" section is run. Applied versions are recorded in
+// schema_migrations so that restarts are no-ops.
+func runMigrations(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version TEXT PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	files, err := fs.Glob(migrationsFS, "sql/schema/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	if err := adoptExistingSchema(db, files); err != nil {
+		return fmt.Errorf("adopting existing schema: %w", err)
+	}
+
+	for _, file := range files {
+		version := migrationVersion(file)
+
+		var applied bool
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("checking migration %s: %w", version, err)
+		}
+		if applied {
+			continue
+		}
+
+		contents, err := migrationsFS.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		if err := applyMigration(db, version, upSection(string(contents))); err != nil {
+			return fmt.Errorf("applying migration %s: %w", version, err)
+		}
+		slog.Info("applied migration", "version", version)
+	}
+
+	return nil
+}
+
+// legacyMigrations are the versions that predate runMigrations, each with a
+// query reporting whether a database set up by hand already has it.
+var legacyMigrations = []struct {
+	version string
+	probe   string
+}{
+	{"001_users", "SELECT to_regclass('users') IS NOT NULL"},
+	{"002_chirps", "SELECT to_regclass('chirps') IS NOT NULL"},
+	{"003_users_hashed_password", columnExistsQuery("users", "hashed_password")},
+	{"004_refresh_tokens", "SELECT to_regclass('refresh_tokens') IS NOT NULL"},
+	{"005_users_is_chirpy_red", columnExistsQuery("users", "is_chirpy_red")},
+}
+
+func columnExistsQuery(table, column string) string {
+	return fmt.Sprintf(`SELECT EXISTS (
+    SELECT 1 FROM information_schema.columns
+    WHERE table_schema = current_schema() AND table_name = '%s' AND column_name = '%s'
+)`, table, column)
+}
+
+// adoptExistingSchema records the migrations a database already has when
+// schema_migrations is still empty, so that databases created before
+// runMigrations existed aren't migrated a second time. Versions come from
+// goose's goose_db_version table when there is one; otherwise each legacy
+// migration is probed for directly.
+func adoptExistingSchema(db *sql.DB, files []string) error {
+	var tracked bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations)").Scan(&tracked); err != nil {
+		return err
+	}
+	if tracked {
+		return nil
+	}
+
+	var applied []string
+	var hasGoose bool
+	if err := db.QueryRow("SELECT to_regclass('goose_db_version') IS NOT NULL").Scan(&hasGoose); err != nil {
+		return err
+	}
+	if hasGoose {
+		versions, err := gooseAppliedVersions(db)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			version := migrationVersion(file)
+			number, _, _ := strings.Cut(version, "_")
+			if n, err := strconv.ParseInt(number, 10, 64); err == nil && versions[n] {
+				applied = append(applied, version)
+			}
+		}
+	} else {
+		for _, m := range legacyMigrations {
+			var present bool
+			if err := db.QueryRow(m.probe).Scan(&present); err != nil {
+				return fmt.Errorf("probing %s: %w", m.version, err)
+			}
+			if present {
+				applied = append(applied, m.version)
+			}
+		}
+	}
+
+	for _, version := range applied {
+		if _, err := db.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			return err
+		}
+		slog.Info("marked existing migration as applied", "version", version)
+	}
+	return nil
+}
+
+// gooseAppliedVersions returns the versions goose considers applied: those
+// whose most recent goose_db_version row has is_applied set.
+func gooseAppliedVersions(db *sql.DB) (map[int64]bool, error) {
+	rows, err := db.Query(`SELECT DISTINCT ON (version_id) version_id, is_applied
+FROM goose_db_version
+ORDER BY version_id, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		if err := rows.Scan(&version, &isApplied); err != nil {
+			return nil, err
+		}
+		versions[version] = isApplied
+	}
+	return versions, rows.Err()
+}
+
+// migrationVersion turns "sql/schema/001_users.sql" into "001_users".
+func migrationVersion(file string) string {
+	return strings.TrimSuffix(file[strings.LastIndex(file, "/")+1:], ".sql")
+}
+
+func applyMigration(db *sql.DB, version, statements string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(statements); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// upSection returns the part of a goose migration between the Up and Down
+// annotations.
+func upSection(migration string) string {
+	_, up, found := strings.Cut(migration, "-- +goose Up")
+	if !found {
+		up = migration
+	}
+	up, _, _ = strings.Cut(up, "-- +goose Down")
+	return strings.TrimSpace(up)
+}
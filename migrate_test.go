@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// newTestDB connects to DB_URL with a fresh, empty schema as the search
+// path, and drops that schema when the test ends. Tests that need a
+// database are skipped when DB_URL is unset.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		t.Skip("DB_URL not set")
+	}
+
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "chirpy_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("dropping schema: %v", err)
+		}
+	})
+
+	dsn := withDSNParam(withDSNParam(dbURL, "timezone", "UTC"), "search_path", schema)
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newMigratedTestDB is newTestDB with every migration applied.
+func newMigratedTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := newTestDB(t)
+	if err := runMigrations(db); err != nil {
+		t.Fatalf("runMigrations: %v", err)
+	}
+	return db
+}
+
+func countAppliedMigrations(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func migrationFileCount(t *testing.T) int {
+	t.Helper()
+	entries, err := migrationsFS.ReadDir("sql/schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+// applyLegacySchema creates the first n migrations by hand, the way
+// databases were set up before runMigrations existed.
+func applyLegacySchema(t *testing.T, db *sql.DB, n int) {
+	t.Helper()
+	for _, m := range legacyMigrations[:n] {
+		contents, err := migrationsFS.ReadFile("sql/schema/" + m.version + ".sql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(upSection(string(contents))); err != nil {
+			t.Fatalf("applying %s by hand: %v", m.version, err)
+		}
+	}
+}
+
+func TestRunMigrationsTwice(t *testing.T) {
+	db := newMigratedTestDB(t)
+	if err := runMigrations(db); err != nil {
+		t.Fatalf("second runMigrations: %v", err)
+	}
+	if got, want := countAppliedMigrations(t, db), migrationFileCount(t); got != want {
+		t.Errorf("schema_migrations has %d rows, want %d", got, want)
+	}
+}
+
+func TestRunMigrationsExistingSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		legacy int
+	}{
+		{"users and chirps only", 2},
+		{"all legacy migrations", len(legacyMigrations)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			applyLegacySchema(t, db, tt.legacy)
+
+			if err := runMigrations(db); err != nil {
+				t.Fatalf("runMigrations on existing schema: %v", err)
+			}
+			if got, want := countAppliedMigrations(t, db), migrationFileCount(t); got != want {
+				t.Errorf("schema_migrations has %d rows, want %d", got, want)
+			}
+			var present bool
+			if err := db.QueryRow(columnExistsQuery("users", "username")).Scan(&present); err != nil {
+				t.Fatal(err)
+			}
+			if !present {
+				t.Error("later migrations were not applied")
+			}
+		})
+	}
+}
+
+func TestRunMigrationsGooseSchema(t *testing.T) {
+	db := newTestDB(t)
+	applyLegacySchema(t, db, len(legacyMigrations))
+	_, err := db.Exec(`CREATE TABLE goose_db_version (
+    id SERIAL PRIMARY KEY,
+    version_id BIGINT NOT NULL,
+    is_applied BOOLEAN NOT NULL,
+    tstamp TIMESTAMP DEFAULT NOW()
+)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v := 0; v <= len(legacyMigrations); v++ {
+		if _, err := db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, TRUE)", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := runMigrations(db); err != nil {
+		t.Fatalf("runMigrations on goose schema: %v", err)
+	}
+	if got, want := countAppliedMigrations(t, db), migrationFileCount(t); got != want {
+		t.Errorf("schema_migrations has %d rows, want %d", got, want)
+	}
+}
+
+func TestMigrationVersion(t *testing.T) {
+	if got := migrationVersion("sql/schema/001_users.sql"); got != "001_users" {
+		t.Errorf("migrationVersion = %q, want %q", got, "001_users")
+	}
+}
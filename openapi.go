@@ -0,0 +1,23 @@
+package main
+
+import (
+	"embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var openAPIFS embed.FS
+
+// openAPIHandler serves the hand-maintained OpenAPI spec. Keep openapi.json
+// in step with the routes registered in main.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	spec, err := openAPIFS.ReadFile("openapi.json")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load OpenAPI spec")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(spec)
+}
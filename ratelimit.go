@@ -0,0 +1,168 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimitPerMinute = 60
+	rateLimitCleanupInterval  = time.Minute
+	rateLimitBucketTTL        = 10 * time.Minute
+)
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// rateLimiter is a token-bucket limiter keyed by client IP. Each bucket
+// holds up to perMinute tokens and refills continuously.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	perMinute int
+	// trustedProxies decides which client a request is counted against;
+	// see clientIP.
+	trustedProxies []netip.Prefix
+}
+
+func newRateLimiter(perMinute int, trustedProxies []netip.Prefix) *rateLimiter {
+	rl := &rateLimiter{
+		buckets:        make(map[string]*bucket),
+		perMinute:      perMinute,
+		trustedProxies: trustedProxies,
+	}
+	go rl.cleanup()
+	return rl
+}
+
+// allow takes a token from the bucket for key. When the bucket is empty it
+// returns false along with how long until the next token is available.
+func (rl *rateLimiter) allow(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	capacity := float64(rl.perMinute)
+	refillRate := capacity / time.Minute.Seconds()
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, lastSeen: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.lastSeen).Seconds()*refillRate)
+	b.lastSeen = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / refillRate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+func (rl *rateLimiter) cleanup() {
+	ticker := time.NewTicker(rateLimitCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rl.mu.Lock()
+		for key, b := range rl.buckets {
+			if time.Since(b.lastSeen) > rateLimitBucketTTL {
+				delete(rl.buckets, key)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := rl.allow(clientIP(r, rl.trustedProxies))
+		if !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			respondWithError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseTrustedProxies parses a comma-separated list of IPs and CIDRs.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strings.Contains(part, "/") {
+			prefix, err := netip.ParsePrefix(part)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+func isTrustedProxy(ip string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that made r. X-Forwarded-For
+// is only consulted when the direct peer is in trustedProxies, and is then
+// walked from the right, skipping further trusted hops, so the result is
+// the leftmost address no trusted proxy vouches for. Entries to the left of
+// it were supplied by the client and may be spoofed.
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrustedProxy(host, trustedProxies) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop, trustedProxies) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
@@ -0,0 +1,17 @@
+-- name: GetUserIDsByUsernames :many
+SELECT id FROM users
+WHERE LOWER(username) = ANY(sqlc.arg('usernames')::text[]);
+
+-- name: CreateChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: GetMentionsForChirps :many
+SELECT chirp_id, user_id FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, user_id;
@@ -0,0 +1,13 @@
+-- name: ReportChirp :exec
+INSERT INTO chirp_reports (reporter_id, chirp_id, reason, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (reporter_id, chirp_id) DO NOTHING;
+
+-- name: ListReportedChirps :many
+SELECT chirp_reports.chirp_id, chirps.body, COUNT(*) AS report_count,
+    MAX(chirp_reports.created_at)::timestamp AS last_reported_at
+FROM chirp_reports
+JOIN chirps ON chirps.id = chirp_reports.chirp_id
+GROUP BY chirp_reports.chirp_id, chirps.body
+ORDER BY report_count DESC, last_reported_at DESC
+LIMIT $1 OFFSET $2;
@@ -0,0 +1,124 @@
+-- name: CountAllChirps :one
+SELECT COUNT(*) FROM chirps;
+
+-- name: CountChirpsByUserSince :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND created_at > $2;
+
+-- name: CreateChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id, client_ip_hash)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetChirps :many
+SELECT * FROM chirps
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('since')::timestamp IS NULL OR created_at > sqlc.narg('since')::timestamp)
+  AND (sqlc.narg('before')::timestamp IS NULL OR created_at < sqlc.narg('before')::timestamp)
+  AND (sqlc.arg('include_deleted')::bool OR deleted_at IS NULL)
+  AND NOT (
+    sqlc.arg('hide_censored')::bool
+    AND position(sqlc.arg('censor_replacement')::text IN body) > 0
+    AND regexp_replace(replace(body, sqlc.arg('censor_replacement')::text, ''), '[[:punct:][:space:]]', '', 'g') = ''
+  )
+ORDER BY
+    CASE WHEN sqlc.arg('sort_desc')::bool THEN created_at END DESC,
+    created_at ASC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: GetChirpsByAuthorAfter :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg('user_id')
+  AND deleted_at IS NULL
+  AND (created_at, id) > (sqlc.arg('after_created_at')::timestamp, sqlc.arg('after_id')::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpsByClientIPHash :many
+SELECT * FROM chirps
+WHERE client_ip_hash = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: GetChirpsWithAuthor :many
+SELECT chirps.*, users.email AS author_email FROM chirps
+LEFT JOIN users ON users.id = chirps.user_id
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR chirps.user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('since')::timestamp IS NULL OR chirps.created_at > sqlc.narg('since')::timestamp)
+  AND (sqlc.narg('before')::timestamp IS NULL OR chirps.created_at < sqlc.narg('before')::timestamp)
+  AND (sqlc.arg('include_deleted')::bool OR chirps.deleted_at IS NULL)
+  AND NOT (
+    sqlc.arg('hide_censored')::bool
+    AND position(sqlc.arg('censor_replacement')::text IN chirps.body) > 0
+    AND regexp_replace(replace(chirps.body, sqlc.arg('censor_replacement')::text, ''), '[[:punct:][:space:]]', '', 'g') = ''
+  )
+ORDER BY
+    CASE WHEN sqlc.arg('sort_desc')::bool THEN chirps.created_at END DESC,
+    chirps.created_at ASC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: GetChirpByID :one
+SELECT * FROM chirps
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetChirpByIDIncludingDeleted :one
+SELECT * FROM chirps
+WHERE id = $1;
+
+-- name: DeleteAllChirps :execrows
+DELETE FROM chirps;
+
+-- name: DeleteChirpsByUser :execrows
+DELETE FROM chirps
+WHERE user_id = $1;
+
+-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: CountChirps :one
+SELECT COUNT(*) FROM chirps
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('since')::timestamp IS NULL OR created_at > sqlc.narg('since')::timestamp)
+  AND (sqlc.narg('before')::timestamp IS NULL OR created_at < sqlc.narg('before')::timestamp)
+  AND (sqlc.arg('include_deleted')::bool OR deleted_at IS NULL)
+  AND NOT (
+    sqlc.arg('hide_censored')::bool
+    AND position(sqlc.arg('censor_replacement')::text IN body) > 0
+    AND regexp_replace(replace(body, sqlc.arg('censor_replacement')::text, ''), '[[:punct:][:space:]]', '', 'g') = ''
+  );
+
+-- name: SearchChirps :many
+SELECT * FROM chirps
+WHERE body ILIKE '%' || sqlc.arg('term')::text || '%' ESCAPE '\'
+  AND deleted_at IS NULL
+ORDER BY created_at ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpReplies :many
+SELECT * FROM chirps
+WHERE parent_id = $1 AND deleted_at IS NULL
+ORDER BY created_at ASC
+LIMIT $2;
+
+-- name: GetFeed :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1 AND chirps.deleted_at IS NULL
+ORDER BY chirps.created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: GetRandomChirp :one
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+ORDER BY RANDOM()
+LIMIT 1;
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body = sqlc.arg('body'), updated_at = NOW()
+WHERE id = sqlc.arg('id') AND deleted_at IS NULL
+  AND (sqlc.narg('unmodified_since')::timestamp IS NULL
+    OR date_trunc('second', updated_at) <= sqlc.narg('unmodified_since')::timestamp)
+RETURNING *;
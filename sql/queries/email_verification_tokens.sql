@@ -0,0 +1,15 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token, user_id, created_at, expires_at)
+VALUES ($1, $2, NOW(), $3);
+
+-- name: GetEmailVerificationToken :one
+SELECT * FROM email_verification_tokens
+WHERE token = $1;
+
+-- name: DeleteEmailVerificationTokensByUser :exec
+DELETE FROM email_verification_tokens
+WHERE user_id = $1;
+
+-- name: DeleteEmailVerificationToken :exec
+DELETE FROM email_verification_tokens
+WHERE token = $1;
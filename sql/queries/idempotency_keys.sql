@@ -0,0 +1,14 @@
+-- name: GetIdempotentChirp :one
+SELECT chirps.* FROM idempotency_keys
+JOIN chirps ON chirps.id = idempotency_keys.chirp_id
+WHERE idempotency_keys.user_id = $1
+  AND idempotency_keys.key = $2
+  AND idempotency_keys.created_at > $3
+  AND chirps.deleted_at IS NULL;
+
+-- name: ClaimIdempotencyKey :execrows
+INSERT INTO idempotency_keys (key, user_id, chirp_id, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id, key) DO UPDATE
+SET chirp_id = EXCLUDED.chirp_id, created_at = EXCLUDED.created_at
+WHERE idempotency_keys.created_at <= $4;
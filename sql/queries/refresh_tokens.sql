@@ -0,0 +1,17 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+VALUES ($1, NOW(), NOW(), $2, $3, NULL)
+RETURNING *;
+
+-- name: GetUserIDFromRefreshToken :one
+SELECT user_id FROM refresh_tokens
+WHERE token = $1 AND expires_at > NOW() AND revoked_at IS NULL;
+
+-- name: DeleteRefreshTokensByUser :execrows
+DELETE FROM refresh_tokens
+WHERE user_id = $1;
+
+-- name: RevokeRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE token = $1;
@@ -1,7 +1,55 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
 RETURNING *;
 
--- name: DeleteAllUsers :exec
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = $1;
+
+-- name: ListUsersWithChirpCounts :many
+SELECT users.id, users.email, users.created_at, users.is_chirpy_red, COUNT(chirps.id) AS chirp_count
+FROM users
+LEFT JOIN chirps ON chirps.user_id = users.id AND chirps.deleted_at IS NULL
+GROUP BY users.id
+ORDER BY users.created_at ASC
+LIMIT $1 OFFSET $2;
+
+-- name: UpdateUser :one
+UPDATE users
+SET email = $2, hashed_password = $3, email_verified = email_verified AND email = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteAllUsers :execrows
 DELETE FROM users;
+
+-- name: CountUsers :one
+SELECT COUNT(*) FROM users;
+
+-- name: UpgradeUserToChirpyRed :execrows
+UPDATE users
+SET is_chirpy_red = TRUE, updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkUserEmailVerified :exec
+UPDATE users
+SET email_verified = TRUE, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUsersByIDs :many
+SELECT * FROM users
+WHERE id = ANY(sqlc.arg('ids')::uuid[])
+ORDER BY created_at ASC;
+
+-- name: GetUserByUsername :one
+SELECT * FROM users
+WHERE LOWER(username) = LOWER($1);
+
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE chirps ADD COLUMN parent_id UUID REFERENCES chirps(id) ON DELETE CASCADE;
+CREATE INDEX chirps_parent_id_idx ON chirps(parent_id);
+
+-- +goose Down
+DROP INDEX chirps_parent_id_idx;
+ALTER TABLE chirps DROP COLUMN parent_id;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE chirp_reports (
+    reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (reporter_id, chirp_id)
+);
+CREATE INDEX chirp_reports_chirp_id_idx ON chirp_reports(chirp_id);
+
+-- +goose Down
+DROP TABLE chirp_reports;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE chirps ADD COLUMN client_ip_hash TEXT;
+CREATE INDEX chirps_client_ip_hash_idx ON chirps(client_ip_hash) WHERE client_ip_hash IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_client_ip_hash_idx;
+ALTER TABLE chirps DROP COLUMN client_ip_hash;
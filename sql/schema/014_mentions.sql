@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN username TEXT;
+CREATE UNIQUE INDEX users_username_idx ON users(LOWER(username));
+
+CREATE TABLE chirp_mentions (
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (chirp_id, user_id)
+);
+CREATE INDEX chirp_mentions_user_id_idx ON chirp_mentions(user_id);
+
+-- +goose Down
+DROP TABLE chirp_mentions;
+DROP INDEX users_username_idx;
+ALTER TABLE users DROP COLUMN username;
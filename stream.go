@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// streamBufferSize is how many chirps a subscriber may fall behind by
+	// before new ones are dropped for it.
+	streamBufferSize = 16
+	// streamKeepAlive is how often an idle stream gets a comment line, so
+	// that proxies don't close the connection.
+	streamKeepAlive = 30 * time.Second
+)
+
+// chirpBroadcaster fans newly created chirps out to every open
+// /api/chirps/stream connection.
+type chirpBroadcaster struct {
+	mu     sync.Mutex
+	subs   map[chan chirp]struct{}
+	closed bool
+}
+
+func newChirpBroadcaster() *chirpBroadcaster {
+	return &chirpBroadcaster{subs: make(map[chan chirp]struct{})}
+}
+
+// subscribe registers a new listener. The channel is closed when the
+// listener unsubscribes or the broadcaster shuts down.
+func (b *chirpBroadcaster) subscribe() (<-chan chirp, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan chirp, streamBufferSize)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// publish hands c to every subscriber without blocking. A subscriber whose
+// buffer is full misses the chirp rather than holding up the poster.
+func (b *chirpBroadcaster) publish(c chirp) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- c:
+		default:
+		}
+	}
+}
+
+// close ends every open stream. It is registered with the server's
+// shutdown so that streams don't hold up a graceful shutdown.
+func (b *chirpBroadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// streamChirpsHandler holds the connection open and sends each new chirp as
+// a Server-Sent Event until the client goes away or the server shuts down.
+func (cfg *apiConfig) streamChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// The stream outlives the server-wide WriteTimeout by design.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("could not clear write deadline for chirp stream", "error", err)
+	}
+
+	chirps, unsubscribe := cfg.chirpStream.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case c, ok := <-chirps:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(c)
+			if err != nil {
+				slog.Error("failed to marshal streamed chirp", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: chirp\nid: %s\ndata: %s\n\n", c.ID, data); err != nil {
+				return
+			}
+		}
+		rc.Flush()
+	}
+}
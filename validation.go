@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// validationErrors collects every problem with a request so that clients
+// can fix all of them in one pass. The first message added doubles as the
+// top-level error string, which is what clients saw before field details
+// existed.
+type validationErrors struct {
+	message string
+	fields  map[string]string
+}
+
+func (v *validationErrors) add(field, problem, message string) {
+	if v.fields == nil {
+		v.fields = make(map[string]string)
+		v.message = message
+	}
+	v.fields[field] = problem
+}
+
+func (v *validationErrors) ok() bool {
+	return len(v.fields) == 0
+}
+
+// atIndex rewrites the errors for one element of a batch request, prefixing
+// each field with the element's index so clients can locate the bad entry.
+func (v *validationErrors) atIndex(i int) *validationErrors {
+	out := &validationErrors{
+		message: fmt.Sprintf("Chirp %d: %s", i, v.message),
+		fields:  make(map[string]string, len(v.fields)),
+	}
+	for field, problem := range v.fields {
+		out.fields[fmt.Sprintf("%d.%s", i, field)] = problem
+	}
+	return out
+}
+
+func respondWithValidationErrors(w http.ResponseWriter, v *validationErrors) {
+	respondWithJSON(w, http.StatusBadRequest, validationErrorResponse{
+		Error:  v.message,
+		Fields: v.fields,
+	})
+}
+
+func validateUserRequest(req userRequest, minPasswordLength int) *validationErrors {
+	errs := &validationErrors{}
+	if req.Email == "" {
+		errs.add("email", "required", "Email is required")
+	} else if err := validateEmail(req.Email); err != nil {
+		errs.add("email", "invalid", "Invalid email")
+	}
+	if req.Password == "" {
+		errs.add("password", "required", "Password is required")
+	} else if err := validatePassword(req.Password, minPasswordLength); err != nil {
+		errs.add("password", "weak", err.Error())
+	}
+	return errs
+}
+
+const defaultMinPasswordLength = 8
+
+// commonPasswords is a deliberately small blocklist of the passwords that
+// top every breach list.
+var commonPasswords = map[string]bool{
+	"password":    true,
+	"password1":   true,
+	"password123": true,
+	"12345678":    true,
+	"123456789":   true,
+	"1234567890":  true,
+	"qwerty":      true,
+	"qwerty123":   true,
+	"qwertyuiop":  true,
+	"iloveyou":    true,
+	"letmein":     true,
+	"welcome":     true,
+	"admin":       true,
+	"abc123":      true,
+	"football":    true,
+	"monkey":      true,
+	"dragon":      true,
+	"sunshine":    true,
+	"baseball":    true,
+	"trustno1":    true,
+}
+
+// validatePassword rejects passwords shorter than minPasswordLength
+// characters or too common. The error text is suitable for showing to the
+// user.
+func validatePassword(password string, minPasswordLength int) error {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return fmt.Errorf("Password must be at least %d characters", minPasswordLength)
+	}
+	if commonPasswords[strings.ToLower(password)] {
+		return errors.New("Password is too common")
+	}
+	return nil
+}
+
+// validateChirpRequest checks the body as it will be stored, that is after
+// normalizeChirpBody, so padding doesn't count against the length limit,
+// which is in characters rather than bytes.
+// A body containing any of rejectedWords is refused outright rather than
+// censored.
+func validateChirpRequest(req chirpRequest, maxLength int, rejectedWords []string) *validationErrors {
+	errs := &validationErrors{}
+	body := normalizeChirpBody(req.Body)
+	if req.Body == "" {
+		errs.add("body", "required", "Chirp body is required")
+	} else if body == "" {
+		errs.add("body", "empty", "Chirp is empty")
+	} else if utf8.RuneCountInString(body) > maxLength {
+		errs.add("body", "too_long", fmt.Sprintf("Chirp is too long (max %d characters)", maxLength))
+	} else if containsWord(body, rejectedWords) {
+		errs.add("body", "rejected", "Chirp contains a prohibited word")
+	}
+	return errs
+}
+
+// normalizeChirpBody trims the body and collapses every run of whitespace,
+// including tabs and newlines, to a single space.
+func normalizeChirpBody(body string) string {
+	return strings.Join(strings.Fields(body), " ")
+}
+
+// normalizeUsername lowercases the username so that lookups and the unique
+// index agree on case.
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return err
+	}
+	// ParseAddress also accepts forms like "Name <a@b.c>"; only the bare
+	// address is allowed here.
+	if addr.Address != email {
+		return errors.New("email must be a bare address")
+	}
+	return nil
+}
+
+// isValidUsername reports whether name is 3 to 30 ASCII letters, digits or
+// underscores.
+func isValidUsername(name string) bool {
+	if len(name) < 3 || len(name) > 30 {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && (r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
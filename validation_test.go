@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeChirpBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"already clean", "hello world", "hello world"},
+		{"leading and trailing spaces", "  hello world  ", "hello world"},
+		{"doubled spaces", "hello   world", "hello world"},
+		{"tabs", "\thello\t\tworld\t", "hello world"},
+		{"newlines", "hello\n\nworld\r\n", "hello world"},
+		{"only whitespace", " \t\n ", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeChirpBody(tt.body); got != tt.want {
+				t.Errorf("normalizeChirpBody(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateChirpRequestEmptyAfterTrim(t *testing.T) {
+	errs := validateChirpRequest(chirpRequest{Body: "\t\n  "}, 140, nil)
+	if errs.ok() {
+		t.Fatal("validateChirpRequest accepted a whitespace-only body")
+	}
+	if errs.fields["body"] != "empty" || errs.message != "Chirp is empty" {
+		t.Errorf("got %q / %q, want %q / %q", errs.fields["body"], errs.message, "empty", "Chirp is empty")
+	}
+}
+
+func TestValidateChirpRequestPaddingDoesNotCount(t *testing.T) {
+	body := "\t" + "hello world" + "\n\n\n\n\n\n"
+	if errs := validateChirpRequest(chirpRequest{Body: body}, len("hello world"), nil); !errs.ok() {
+		t.Errorf("validateChirpRequest rejected a padded body: %v", errs.fields)
+	}
+}
+
+func TestValidateChirpRequestRejectedWord(t *testing.T) {
+	rejected := []string{"spam"}
+	errs := validateChirpRequest(chirpRequest{Body: "buy my SPAM!"}, 140, rejected)
+	if errs.ok() {
+		t.Fatal("validateChirpRequest accepted a chirp with a rejected word")
+	}
+	if errs.fields["body"] != "rejected" {
+		t.Errorf("body problem = %q, want %q", errs.fields["body"], "rejected")
+	}
+	if errs := validateChirpRequest(chirpRequest{Body: "spammy but fine"}, 140, rejected); !errs.ok() {
+		t.Errorf("validateChirpRequest rejected a substring match: %v", errs.fields)
+	}
+}
+
+func TestValidateChirpRequestCountsCharacters(t *testing.T) {
+	body := strings.Repeat("é", 100)
+	if errs := validateChirpRequest(chirpRequest{Body: body}, 100, nil); !errs.ok() {
+		t.Errorf("validateChirpRequest rejected 100 characters at a 100 limit: %v", errs.fields)
+	}
+	body += "é"
+	if errs := validateChirpRequest(chirpRequest{Body: body}, 100, nil); errs.fields["body"] != "too_long" {
+		t.Errorf("body problem = %q, want %q", errs.fields["body"], "too_long")
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"long enough", "correct horse battery", false},
+		{"too short", "abc12", true},
+		{"one below the minimum", "abcdefg", true},
+		{"blocklisted", "password123", true},
+		{"blocklisted ignoring case", "PassWord123", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePassword(tt.password, defaultMinPasswordLength)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validatePassword(%q) error = %v, wantErr %v", tt.password, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateUserRequestWeakPassword(t *testing.T) {
+	errs := validateUserRequest(userRequest{Email: "a@example.com", Password: "qwerty123"}, defaultMinPasswordLength)
+	if got := errs.fields["password"]; got != "weak" {
+		t.Errorf("password problem = %q, want %q", got, "weak")
+	}
+}